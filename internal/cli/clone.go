@@ -3,7 +3,6 @@ package cli
 import (
 	"fmt"
 	"os"
-	"path/filepath"
 
 	"github.com/JPlanken/metarepo-cli/internal/config"
 	"github.com/JPlanken/metarepo-cli/internal/git"
@@ -29,12 +28,12 @@ var (
 func init() {
 	rootCmd.AddCommand(cloneCmd)
 	cloneCmd.Flags().BoolVar(&cloneDryRun, "dry-run", false, "show what would be cloned without actually cloning")
-	cloneCmd.Flags().IntVarP(&cloneParallel, "parallel", "p", 1, "number of parallel clones (default 1)")
+	cloneCmd.Flags().IntVarP(&cloneParallel, "parallel", "p", 1, "number of parallel clones")
 }
 
 func runClone(cmd *cobra.Command, args []string) error {
 	// Load manifest
-	manifestPath := filepath.Join(".metarepo", "manifest.yaml")
+	manifestPath := metarepoPath("manifest.yaml")
 	manifest, err := config.LoadManifest(manifestPath)
 	if err != nil {
 		return fmt.Errorf("failed to load manifest: %w", err)
@@ -45,57 +44,62 @@ func runClone(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
-	fmt.Printf("Found %d repositories in manifest\n\n", len(manifest.Repositories))
+	repos := selectManifestByTag(manifest.Repositories)
+	if tagSelectionActive() {
+		fmt.Printf("Found %d repositories in manifest (%d selected by tag)\n\n", len(manifest.Repositories), len(repos))
+	} else {
+		fmt.Printf("Found %d repositories in manifest\n\n", len(manifest.Repositories))
+	}
 
-	clonedCount := 0
-	skippedCount := 0
-	errorCount := 0
+	results := runOrdered(repos, cloneParallel, cloneRepo, printCloneResult)
+	summary := summarizeResults(results)
 
-	for _, repo := range manifest.Repositories {
-		repoPath := repo.Path
-		if repoPath == "" {
-			repoPath = repo.Name
-		}
+	fmt.Println()
+	fmt.Println("Summary:")
+	fmt.Printf("  Cloned:  %d\n", summary.OK)
+	fmt.Printf("  Skipped: %d\n", summary.Skipped)
+	if summary.Failed > 0 {
+		fmt.Printf("  Errors:  %d\n", summary.Failed)
+	}
 
-		// Check if already exists
-		if _, err := os.Stat(repoPath); err == nil {
-			if git.IsGitRepo(repoPath) {
-				fmt.Printf("  [SKIP] %s (already exists)\n", repo.Name)
-				skippedCount++
-				continue
-			}
-		}
+	return nil
+}
 
-		// Check if URL is available
-		if repo.URL == "" {
-			fmt.Printf("  [SKIP] %s (no URL)\n", repo.Name)
-			skippedCount++
-			continue
-		}
+// cloneRepo clones a single manifest repository unless it already exists
+func cloneRepo(repo config.Repository) opResult {
+	repoPath := workspacePath(repo.LocalPath())
 
-		if cloneDryRun {
-			fmt.Printf("  [DRY] %s → %s\n", repo.Name, repoPath)
-			continue
+	// Check if already exists
+	if _, err := os.Stat(repoPath); err == nil {
+		if git.IsGitRepo(repoPath) {
+			return opResult{Name: repo.Name, Status: opSkipped, Reason: "already exists"}
 		}
+	}
 
-		fmt.Printf("  [CLONE] %s... ", repo.Name)
+	// Check if URL is available
+	if repo.URL == "" {
+		return opResult{Name: repo.Name, Status: opSkipped, Reason: "no URL"}
+	}
 
-		if err := git.Clone(repo.URL, repoPath); err != nil {
-			fmt.Println("FAILED")
-			errorCount++
-		} else {
-			fmt.Println("OK")
-			clonedCount++
-		}
+	if cloneDryRun {
+		return opResult{Name: repo.Name, Status: opDryRun, Reason: repo.LocalPath()}
 	}
 
-	fmt.Println()
-	fmt.Println("Summary:")
-	fmt.Printf("  Cloned:  %d\n", clonedCount)
-	fmt.Printf("  Skipped: %d\n", skippedCount)
-	if errorCount > 0 {
-		fmt.Printf("  Errors:  %d\n", errorCount)
+	if err := git.CloneQuiet(repo.URL, repoPath); err != nil {
+		return opResult{Name: repo.Name, Status: opFailed, Err: err}
 	}
+	return opResult{Name: repo.Name, Status: opOK}
+}
 
-	return nil
+func printCloneResult(repo config.Repository, res opResult) {
+	switch res.Status {
+	case opSkipped:
+		fmt.Printf("  [SKIP] %s (%s)\n", res.Name, res.Reason)
+	case opDryRun:
+		fmt.Printf("  [DRY] %s → %s\n", res.Name, res.Reason)
+	case opFailed:
+		fmt.Printf("  [CLONE] %s... FAILED (%v)\n", res.Name, res.Err)
+	default:
+		fmt.Printf("  [CLONE] %s... OK\n", res.Name)
+	}
 }
@@ -0,0 +1,729 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/JPlanken/metarepo-cli/internal/config"
+	"github.com/JPlanken/metarepo-cli/internal/fsutil"
+	"github.com/JPlanken/metarepo-cli/internal/sync"
+	"github.com/JPlanken/metarepo-cli/internal/textdiff"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// historyDir holds the snapshots of every device's workspace-config
+func historyDir() string {
+	return metarepoPath("history")
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Workspace configuration commands",
+	Long: `Commands for viewing and editing .metarepo/config.yaml, and for inspecting and
+restoring synced workspace configuration.`,
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the effective configuration",
+	Long: `Show the configuration commands run with: the system (/etc/metarepo), user
+(~/.config/metarepo) and workspace config files merged in that order, then
+METAREPO_* environment variables and --set flags.
+
+With --verbose, each value is annotated with the layer it came from.`,
+	Args: cobra.NoArgs,
+	RunE: runConfigShow,
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Print a configuration value",
+	Long: `Print the value at a dotted key, e.g. 'sync.conflict.strategy'. List elements
+are addressed by index or, for sync targets, by name: 'sync.targets.cursor.paths'.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runConfigGet,
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Change a configuration value",
+	Long: `Set the value at a dotted key. The value is checked against the setting's type;
+lists are written as '[a, b]'.
+
+Examples:
+  metarepo config set sync.conflict.strategy manual
+  metarepo config set sync.exclude '["*.log", "cache/"]'
+  metarepo config set sync.targets.vscode.repos true`,
+	Args: cobra.ExactArgs(2),
+	RunE: runConfigSet,
+}
+
+var configEditCmd = &cobra.Command{
+	Use:   "edit",
+	Short: "Edit the configuration in $EDITOR",
+	Long: `Open .metarepo/config.yaml in $VISUAL or $EDITOR. The file is validated when the
+editor exits; invalid changes can be edited again or discarded.`,
+	Args: cobra.NoArgs,
+	RunE: runConfigEdit,
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the configuration for errors",
+	Long: `Report unknown keys, values of the wrong type, invalid conflict strategies and
+malformed patterns in .metarepo/config.yaml, with their line numbers.`,
+	Args: cobra.NoArgs,
+	RunE: runConfigValidate,
+}
+
+var configHistoryCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List workspace-config snapshots",
+	Long: `List the snapshots of workspace-config recorded on every push, newest first,
+with the files changed since the device's previous snapshot.`,
+	RunE: runConfigHistory,
+}
+
+var configRestoreCmd = &cobra.Command{
+	Use:   "restore <snapshot>",
+	Short: "Restore workspace config from a snapshot",
+	Long: `Roll the local IDE directories back to a snapshot listed by 'metarepo config history'.
+The snapshot can be given by a unique prefix of its ID.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runConfigRestore,
+}
+
+var configDiffCmd = &cobra.Command{
+	Use:   "diff [--from <device>] [--to <device>]",
+	Short: "Show workspace config differences between devices",
+	Long: `Show the changes syncing workspace configuration from one device to another
+would make: 'metarepo config diff --from desktop' shows what
+'metarepo pull --from desktop' would change in the working directory.
+
+Without --from, the configuration last pushed from this device is used.
+Without --to, the device is compared against the live working directory.`,
+	Args: cobra.NoArgs,
+	RunE: runConfigDiff,
+}
+
+var (
+	configHistoryDevice string
+	configHistoryLimit  int
+	configRestoreDryRun bool
+	configDiffFrom      string
+	configDiffTo        string
+	configDiffStat      bool
+	configDiffFormat    string
+)
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configShowCmd)
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configEditCmd)
+	configCmd.AddCommand(configValidateCmd)
+	configCmd.AddCommand(configHistoryCmd)
+	configCmd.AddCommand(configRestoreCmd)
+	configCmd.AddCommand(configDiffCmd)
+
+	configHistoryCmd.Flags().StringVarP(&configHistoryDevice, "device", "d", "", "only list snapshots of this device")
+	configHistoryCmd.Flags().IntVarP(&configHistoryLimit, "limit", "n", 10, "maximum number of snapshots to list (0 for all)")
+	configRestoreCmd.Flags().BoolVar(&configRestoreDryRun, "dry-run", false, "show what would be restored without writing anything")
+
+	configDiffCmd.Flags().StringVar(&configDiffFrom, "from", "", "device whose configuration would be synced (default: current device)")
+	configDiffCmd.Flags().StringVar(&configDiffTo, "to", "", "device to compare against (default: working directory)")
+	configDiffCmd.Flags().BoolVar(&configDiffStat, "stat", false, "only show a summary of changed files")
+	configDiffCmd.Flags().StringVarP(&configDiffFormat, "format", "f", "text", "output format (text, json)")
+}
+
+// workspaceConfigPath is the workspace configuration file
+func workspaceConfigPath() string {
+	return metarepoPath("config.yaml")
+}
+
+func runConfigShow(cmd *cobra.Command, args []string) error {
+	cfg, sources, err := loadConfigSources()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := doc.Encode(cfg); err != nil {
+		return err
+	}
+	if verbose {
+		annotateSources(&doc, "", sources)
+	}
+
+	data, err := yaml.Marshal(&doc)
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(data))
+	return nil
+}
+
+// annotateSources comments every value in node with the layer it came from
+func annotateSources(node *yaml.Node, key string, sources config.Sources) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			k, v := node.Content[i], node.Content[i+1]
+			path := k.Value
+			if key != "" {
+				path = key + "." + k.Value
+			}
+			if v.Kind == yaml.MappingNode {
+				annotateSources(v, path, sources)
+				continue
+			}
+			if v.Kind == yaml.SequenceNode && len(v.Content) > 0 && v.Content[0].Kind == yaml.MappingNode {
+				k.LineComment = "from " + sources.Of(path)
+				annotateSources(v, path, sources)
+				continue
+			}
+			k.LineComment = "from " + sources.Of(path)
+		}
+	case yaml.SequenceNode:
+		// Sections in lists are addressed by name where they have one
+		for i, item := range node.Content {
+			name := fmt.Sprint(i)
+			for j := 0; j+1 < len(item.Content); j += 2 {
+				if item.Content[j].Value == "name" {
+					name = item.Content[j+1].Value
+				}
+			}
+			annotateSources(item, key+"."+name, sources)
+		}
+	}
+}
+
+func runConfigGet(cmd *cobra.Command, args []string) error {
+	cfg, sources, err := loadConfigSources()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	value, err := cfg.Get(args[0])
+	if err != nil {
+		return err
+	}
+	if verbose {
+		key, _ := cfg.CanonicalKey(args[0])
+		defer fmt.Fprintf(os.Stderr, "(from %s)\n", sources.Of(key))
+	}
+
+	switch v := value.(type) {
+	case string, bool, int:
+		fmt.Println(v)
+	default:
+		data, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(data))
+	}
+	return nil
+}
+
+func runConfigSet(cmd *cobra.Command, args []string) error {
+	unlock, err := lockWorkspace(cmd)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	cfg, err := config.Load(workspaceConfigPath())
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// Only problems introduced by this change are reported
+	before, err := configIssues(cfg)
+	if err != nil {
+		return err
+	}
+	if err := cfg.Set(args[0], args[1]); err != nil {
+		return err
+	}
+	after, err := configIssues(cfg)
+	if err != nil {
+		return err
+	}
+	for issue := range after {
+		if !before[issue] {
+			return errors.New(issue)
+		}
+	}
+
+	if err := cfg.Save(workspaceConfigPath()); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	fmt.Printf("Set %s = %s\n", args[0], args[1])
+	return nil
+}
+
+// configIssues validates cfg as it would be saved
+func configIssues(cfg *config.Config) (map[string]bool, error) {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	issues, err := config.Validate(data)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]bool, len(issues))
+	for _, issue := range issues {
+		// Line numbers refer to the marshaled config, not the file
+		issue.Line = 0
+		found[issue.String()] = true
+	}
+	return found, nil
+}
+
+func runConfigEdit(cmd *cobra.Command, args []string) error {
+	unlock, err := lockWorkspace(cmd)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	original, err := os.ReadFile(workspaceConfigPath())
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+
+	// Edit a copy so an invalid config never reaches other commands
+	tmp, err := os.CreateTemp("", "metarepo-config-*.yaml")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(original); err != nil {
+		tmp.Close()
+		return err
+	}
+	tmp.Close()
+
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		if err := openEditor(tmp.Name()); err != nil {
+			return err
+		}
+
+		edited, err := os.ReadFile(tmp.Name())
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(edited, original) {
+			fmt.Println("No changes.")
+			return nil
+		}
+
+		issues, err := config.Validate(edited)
+		if err != nil {
+			issues = []config.Issue{{Key: "(file)", Message: err.Error()}}
+		}
+		if len(issues) == 0 {
+			if err := fsutil.WriteFile(workspaceConfigPath(), edited, 0644); err != nil {
+				return fmt.Errorf("failed to save config: %w", err)
+			}
+			fmt.Printf("Saved %s\n", workspaceConfigPath())
+			return nil
+		}
+
+		fmt.Printf("%s has %d problem(s):\n", workspaceConfigPath(), len(issues))
+		for _, issue := range issues {
+			fmt.Printf("  %s\n", issue)
+		}
+		fmt.Print("Edit again? [Y/n]: ")
+		input, _ := reader.ReadString('\n')
+		if answer := strings.ToLower(strings.TrimSpace(input)); answer == "n" || answer == "no" {
+			fmt.Println("Changes discarded.")
+			return nil
+		}
+	}
+}
+
+// openEditor opens path in the user's editor and waits for it to exit
+func openEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+		if runtime.GOOS == "windows" {
+			editor = "notepad"
+		}
+	}
+
+	// The editor may carry arguments, e.g. "code --wait"
+	fields := strings.Fields(editor)
+	cmd := exec.Command(fields[0], append(fields[1:], path)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("editor %s failed: %w", fields[0], err)
+	}
+	return nil
+}
+
+func runConfigValidate(cmd *cobra.Command, args []string) error {
+	data, err := os.ReadFile(workspaceConfigPath())
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+
+	issues, err := config.Validate(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", workspaceConfigPath(), err)
+	}
+	if len(issues) == 0 {
+		fmt.Printf("%s is valid.\n", workspaceConfigPath())
+		return nil
+	}
+
+	for _, issue := range issues {
+		fmt.Printf("%s: %s\n", workspaceConfigPath(), issue)
+	}
+	return fmt.Errorf("%d problem(s) found", len(issues))
+}
+
+// recordSnapshot records the device's workspace-config in the history
+func recordSnapshot(deviceName string) (*sync.Snapshot, error) {
+	dir := metarepoPath("workspace-config", deviceName)
+	return sync.NewHistory(historyDir()).Record(deviceName, dir, time.Now())
+}
+
+func runConfigHistory(cmd *cobra.Command, args []string) error {
+	history := sync.NewHistory(historyDir())
+	snaps, err := history.List(configHistoryDevice)
+	if err != nil {
+		return fmt.Errorf("failed to read history: %w", err)
+	}
+
+	if len(snaps) == 0 {
+		fmt.Println("No snapshots recorded.")
+		return nil
+	}
+
+	shown := snaps
+	if configHistoryLimit > 0 && len(shown) > configHistoryLimit {
+		shown = shown[:configHistoryLimit]
+	}
+
+	for i, snap := range shown {
+		if i > 0 {
+			fmt.Println()
+		}
+		previous, err := history.Previous(snap)
+		if err != nil {
+			return fmt.Errorf("failed to read history: %w", err)
+		}
+
+		fmt.Printf("%s  %s  %s  (%d files)\n", snap.ID, snap.Created.Local().Format("2006-01-02 15:04:05"), snap.Device, len(snap.Files))
+		printChangeSet(snap.Changes(previous), false)
+	}
+
+	if len(shown) < len(snaps) {
+		fmt.Printf("\n%d older snapshots not shown (use --limit 0 to list all)\n", len(snaps)-len(shown))
+	}
+
+	return nil
+}
+
+func runConfigRestore(cmd *cobra.Command, args []string) error {
+	unlock, err := lockWorkspace(cmd)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	history := sync.NewHistory(historyDir())
+	snap, err := history.Find(args[0])
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.MkdirTemp("", "metarepo-restore-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := history.Materialize(snap, tmp); err != nil {
+		return fmt.Errorf("failed to read snapshot: %w", err)
+	}
+
+	placeholders, err := sync.CurrentPlaceholders(workspaceRoot)
+	if err != nil {
+		return fmt.Errorf("failed to resolve workspace paths: %w", err)
+	}
+	incoming := chainTransforms(newDecryptor(cfg).decrypt, placeholders.Expand)
+
+	fmt.Printf("Restoring snapshot %s (%s, %s)...\n", snap.ID, snap.Device, snap.Created.Local().Format("2006-01-02 15:04:05"))
+
+	root := syncScope{pair: sync.Pair{Local: workspaceRoot, Remote: tmp}}
+	var repoScopes []syncScope
+	total := &sync.ChangeSet{}
+	for _, target := range cfg.Sync.Targets {
+		scopes := []syncScope{root}
+		if target.Repos {
+			if repoScopes == nil {
+				if repoScopes, err = reposToSync(cfg, root); err != nil {
+					return err
+				}
+			}
+			scopes = append(scopes, repoScopes...)
+		}
+
+		for _, scope := range scopes {
+			changes, err := sync.Mirror(scope.pair.Remote, scope.pair.Local, target.Paths, sync.Options{
+				Filter:    targetFilter(cfg, target),
+				Transform: incoming,
+				DryRun:    configRestoreDryRun,
+			})
+			if err != nil {
+				return fmt.Errorf("target %s: %sfailed to restore: %w", target.Name, scope.prefix, err)
+			}
+			addChanges(total, changes, scope.prefix)
+		}
+	}
+
+	printChangeSet(total, configRestoreDryRun)
+	if !configRestoreDryRun {
+		fmt.Println("Workspace configuration restored. Run 'metarepo push' to share it.")
+	}
+
+	return nil
+}
+
+// configFileDiff is the difference of one file between two sides
+type configFileDiff struct {
+	Path       string `json:"path"`
+	Status     string `json:"status"` // added, deleted, modified
+	Binary     bool   `json:"binary,omitempty"`
+	Insertions int    `json:"insertions"`
+	Deletions  int    `json:"deletions"`
+	Diff       string `json:"diff,omitempty"`
+}
+
+func runConfigDiff(cmd *cobra.Command, args []string) error {
+	if configDiffFormat != "text" && configDiffFormat != "json" {
+		return fmt.Errorf("unknown format: %s (expected text or json)", configDiffFormat)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if configDiffFrom == "" {
+		if configDiffFrom, err = currentDeviceName(); err != nil {
+			return err
+		}
+	}
+
+	from, err := deviceConfigFiles(cfg, configDiffFrom)
+	if err != nil {
+		return err
+	}
+	toName := "working directory"
+	var to map[string][]byte
+	if configDiffTo != "" {
+		toName = configDiffTo
+		to, err = deviceConfigFiles(cfg, configDiffTo)
+	} else {
+		to, err = localConfigFiles(cfg)
+	}
+	if err != nil {
+		return err
+	}
+
+	// The destination is the old side: it is what a sync would change
+	diffs := diffConfigFiles(to, from, !configDiffStat)
+
+	if configDiffFormat == "json" {
+		out := struct {
+			From  string           `json:"from"`
+			To    string           `json:"to"`
+			Files []configFileDiff `json:"files"`
+		}{configDiffFrom, toName, diffs}
+		if out.Files == nil {
+			out.Files = []configFileDiff{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	}
+
+	if len(diffs) == 0 {
+		fmt.Printf("No differences between %s and %s.\n", configDiffFrom, toName)
+		return nil
+	}
+
+	if configDiffStat {
+		printDiffStat(diffs)
+		return nil
+	}
+
+	for _, d := range diffs {
+		fmt.Printf("diff %s (%s)\n", d.Path, d.Status)
+		if d.Binary {
+			fmt.Println("Binary files differ")
+			continue
+		}
+		fmt.Print(d.Diff)
+	}
+	return nil
+}
+
+// deviceConfigFiles returns the files every sync target covers in a
+// device's workspace-config, as they would be written to the working directory
+func deviceConfigFiles(cfg *config.Config, deviceName string) (map[string][]byte, error) {
+	dir := metarepoPath("workspace-config", deviceName)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil, fmt.Errorf("no configuration found for device: %s", deviceName)
+	}
+
+	placeholders, err := sync.CurrentPlaceholders(workspaceRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve workspace paths: %w", err)
+	}
+	incoming := chainTransforms(newDecryptor(cfg).decrypt, placeholders.Expand)
+
+	// Pulling copies the stored side of each pair to the working directory
+	return targetConfigFiles(cfg, sync.Pair{Local: workspaceRoot, Remote: dir}, incoming)
+}
+
+// localConfigFiles returns the files every sync target covers in the working
+// directory
+func localConfigFiles(cfg *config.Config) (map[string][]byte, error) {
+	return targetConfigFiles(cfg, sync.Pair{Local: workspaceRoot, Push: true}, nil)
+}
+
+// targetConfigFiles reads the files every sync target covers on the source
+// side of pair, and of the matching pair in each repository for targets with
+// repos set. Paths are relative to the workspace.
+func targetConfigFiles(cfg *config.Config, pair sync.Pair, transform sync.TransformFunc) (map[string][]byte, error) {
+	root := syncScope{pair: pair}
+	var repoScopes []syncScope
+
+	files := make(map[string][]byte)
+	for _, target := range cfg.Sync.Targets {
+		scopes := []syncScope{root}
+		if target.Repos {
+			if repoScopes == nil {
+				var err error
+				if repoScopes, err = reposToSync(cfg, root); err != nil {
+					return nil, err
+				}
+			}
+			scopes = append(scopes, repoScopes...)
+		}
+
+		for _, scope := range scopes {
+			dir := scope.pair.Source()
+			found, err := sync.ListFiles(dir, target.Paths, targetFilter(cfg, target))
+			if err != nil {
+				return nil, err
+			}
+			for rel := range found {
+				data, err := sync.ReadFile(dir, rel, transform)
+				if err != nil {
+					return nil, err
+				}
+				files[scope.prefix+rel] = data
+			}
+		}
+	}
+	return files, nil
+}
+
+// diffConfigFiles compares two sets of files. With patch set, the unified
+// diff of each text file is included.
+func diffConfigFiles(old, new map[string][]byte, patch bool) []configFileDiff {
+	paths := make(map[string]bool, len(old)+len(new))
+	for p := range old {
+		paths[p] = true
+	}
+	for p := range new {
+		paths[p] = true
+	}
+	sorted := make([]string, 0, len(paths))
+	for p := range paths {
+		sorted = append(sorted, p)
+	}
+	sort.Strings(sorted)
+
+	var diffs []configFileDiff
+	for _, p := range sorted {
+		a, inOld := old[p]
+		b, inNew := new[p]
+		if inOld && inNew && string(a) == string(b) {
+			continue
+		}
+
+		d := configFileDiff{Path: p, Status: "modified"}
+		oldName, newName := "a/"+p, "b/"+p
+		switch {
+		case !inOld:
+			d.Status, oldName = "added", "/dev/null"
+		case !inNew:
+			d.Status, newName = "deleted", "/dev/null"
+		}
+
+		if sync.IsBinary(a) || sync.IsBinary(b) {
+			d.Binary = true
+		} else {
+			result := textdiff.Compute(a, b)
+			d.Insertions, d.Deletions = result.Insertions, result.Deletions
+			if patch {
+				d.Diff = result.Unified(oldName, newName, 3)
+			}
+		}
+		diffs = append(diffs, d)
+	}
+	return diffs
+}
+
+// printDiffStat prints a line per changed file and a total
+func printDiffStat(diffs []configFileDiff) {
+	width := 0
+	for _, d := range diffs {
+		width = max(width, len(d.Path))
+	}
+
+	insertions, deletions := 0, 0
+	for _, d := range diffs {
+		if d.Binary {
+			fmt.Printf(" %-*s | Bin\n", width, d.Path)
+			continue
+		}
+		insertions += d.Insertions
+		deletions += d.Deletions
+		fmt.Printf(" %-*s | %4d %s%s\n", width, d.Path, d.Insertions+d.Deletions,
+			strings.Repeat("+", min(d.Insertions, 40)), strings.Repeat("-", min(d.Deletions, 40)))
+	}
+	fmt.Printf(" %d files changed, %d insertions(+), %d deletions(-)\n", len(diffs), insertions, deletions)
+}
@@ -4,10 +4,15 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"text/tabwriter"
+	"time"
 
 	"github.com/JPlanken/metarepo-cli/internal/config"
+	"github.com/JPlanken/metarepo-cli/internal/crypt"
 	"github.com/JPlanken/metarepo-cli/internal/device"
+	"github.com/JPlanken/metarepo-cli/internal/sync"
 	"github.com/spf13/cobra"
 )
 
@@ -39,11 +44,88 @@ var deviceRegisterCmd = &cobra.Command{
 	RunE:  runDeviceRegister,
 }
 
+var deviceKeyCmd = &cobra.Command{
+	Use:   "key",
+	Short: "Show this device's public key",
+	Long: `Show the public key other devices encrypt workspace-config to, generating
+the device's key pair on first use. The public key is added to this device's
+registry entry so it becomes a recipient on the next push.`,
+	RunE: runDeviceKey,
+}
+
+var deviceAddKeyCmd = &cobra.Command{
+	Use:   "add-key <device> <public-key>",
+	Short: "Add a device's public key to the recipients",
+	Long: `Record the public key of a registered device, as printed by 'metarepo device key'
+on that device. Workspace-config pushed afterwards is encrypted to it as well.`,
+	Args: cobra.ExactArgs(2),
+	RunE: runDeviceAddKey,
+}
+
+var deviceRenameCmd = &cobra.Command{
+	Use:   "rename <old> <new>",
+	Short: "Rename a registered device",
+	Long: `Rename a device in the registry and move its workspace-config directory to
+the new name.`,
+	Args: cobra.ExactArgs(2),
+	RunE: runDeviceRename,
+}
+
+var deviceRemoveCmd = &cobra.Command{
+	Use:   "remove <name>",
+	Short: "Remove a device from the registry",
+	Long: `Remove a device from the registry together with its workspace-config
+directory. With --archive the directory is moved to .metarepo/archive/ instead
+of being deleted.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runDeviceRemove,
+}
+
+var devicePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove devices that haven't synced for a while",
+	Long: `Remove every device whose last sync (or registration, if it never synced) is
+older than --older-than, e.g. 90d, 12w or 720h. The current device is never
+pruned.`,
+	Args: cobra.NoArgs,
+	RunE: runDevicePrune,
+}
+
+var deviceSetCurrentCmd = &cobra.Command{
+	Use:   "set-current <name>",
+	Short: "Make the current device take over a registered device",
+	Long: `Point the registry entry <name> at the current device, e.g. after replacing a
+laptop. The entry keeps its name and workspace-config; its serial, platform
+and hostname are updated to this device's.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runDeviceSetCurrent,
+}
+
+var (
+	deviceArchive        bool
+	deviceForce          bool
+	devicePruneOlderThan string
+	devicePruneDryRun    bool
+)
+
 func init() {
 	rootCmd.AddCommand(deviceCmd)
 	deviceCmd.AddCommand(deviceInfoCmd)
 	deviceCmd.AddCommand(deviceListCmd)
 	deviceCmd.AddCommand(deviceRegisterCmd)
+	deviceCmd.AddCommand(deviceKeyCmd)
+	deviceCmd.AddCommand(deviceAddKeyCmd)
+	deviceCmd.AddCommand(deviceRenameCmd)
+	deviceCmd.AddCommand(deviceRemoveCmd)
+	deviceCmd.AddCommand(devicePruneCmd)
+	deviceCmd.AddCommand(deviceSetCurrentCmd)
+
+	deviceRemoveCmd.Flags().BoolVar(&deviceArchive, "archive", false, "keep the device's workspace-config in .metarepo/archive/")
+	deviceRemoveCmd.Flags().BoolVarP(&deviceForce, "force", "f", false, "allow removing the current device")
+	devicePruneCmd.Flags().StringVar(&devicePruneOlderThan, "older-than", "", "remove devices not synced for this long (e.g. 90d)")
+	devicePruneCmd.Flags().BoolVar(&deviceArchive, "archive", false, "keep pruned devices' workspace-config in .metarepo/archive/")
+	devicePruneCmd.Flags().BoolVar(&devicePruneDryRun, "dry-run", false, "show the devices that would be removed")
+	devicePruneCmd.MarkFlagRequired("older-than")
 }
 
 func runDeviceInfo(cmd *cobra.Command, args []string) error {
@@ -54,25 +136,34 @@ func runDeviceInfo(cmd *cobra.Command, args []string) error {
 
 	fmt.Println("Current Device:")
 	fmt.Printf("  Serial:   %s\n", info.Serial)
+	fmt.Printf("  Source:   %s\n", device.SourceDescription(info.Source))
+	if info.Environment != "" {
+		fmt.Printf("  Runs in:  %s\n", info.Environment)
+	}
 	fmt.Printf("  Platform: %s\n", info.Platform)
 	fmt.Printf("  Arch:     %s\n", info.Arch)
 	fmt.Printf("  Hostname: %s\n", info.Hostname)
 	fmt.Printf("  Username: %s\n", info.Username)
 
 	// Check if registered in current workspace
-	devicesPath := filepath.Join(".metarepo", "devices.yaml")
+	devicesPath := metarepoPath("devices")
 	if registry, err := config.LoadDeviceRegistry(devicesPath); err == nil {
-		if d := registry.FindDevice(info.Serial); d != nil {
+		if d, _ := findCurrentDevice(registry, info, false); d != nil {
 			fmt.Println()
 			fmt.Printf("  Registered as: %s\n", d.Name)
+			fmt.Printf("  Fingerprint:   %s\n", d.Fingerprint())
 			fmt.Printf("  Registered:    %s\n", d.Registered.Format("2006-01-02 15:04:05"))
 			if !d.LastSync.IsZero() {
 				fmt.Printf("  Last sync:     %s\n", d.LastSync.Format("2006-01-02 15:04:05"))
 			}
+			if d.PublicKey != "" {
+				fmt.Printf("  Public key:    %s\n", d.PublicKey)
+			}
 		} else {
 			fmt.Println()
 			fmt.Println("  Status: Not registered in this workspace")
-			fmt.Println("  Run 'metarepo device register' to register")
+			fmt.Println("  Run 'metarepo device register' to register, or")
+			fmt.Println("  'metarepo device set-current <name>' if its identity changed")
 		}
 	}
 
@@ -80,7 +171,7 @@ func runDeviceInfo(cmd *cobra.Command, args []string) error {
 }
 
 func runDeviceList(cmd *cobra.Command, args []string) error {
-	devicesPath := filepath.Join(".metarepo", "devices.yaml")
+	devicesPath := metarepoPath("devices")
 	registry, err := config.LoadDeviceRegistry(devicesPath)
 	if err != nil {
 		return fmt.Errorf("failed to load device registry: %w", err)
@@ -92,17 +183,17 @@ func runDeviceList(cmd *cobra.Command, args []string) error {
 	}
 
 	// Get current device to mark it
-	currentSerial := ""
+	var currentDevice *config.Device
 	if info, err := device.GetCurrentDevice(); err == nil {
-		currentSerial = info.Serial
+		currentDevice, _ = findCurrentDevice(registry, info, false)
 	}
 
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(w, "NAME\tSERIAL\tPLATFORM\tLAST SYNC\t")
+	fmt.Fprintln(w, "NAME\tFINGERPRINT\tPLATFORM\tLAST SYNC\t")
 
-	for _, d := range registry.Devices {
+	for i, d := range registry.Devices {
 		current := ""
-		if d.Serial == currentSerial {
+		if &registry.Devices[i] == currentDevice {
 			current = " *"
 		}
 
@@ -111,7 +202,7 @@ func runDeviceList(cmd *cobra.Command, args []string) error {
 			lastSync = d.LastSync.Format("2006-01-02 15:04")
 		}
 
-		fmt.Fprintf(w, "%s%s\t%s\t%s\t%s\t\n", d.Name, current, d.Serial, d.Platform, lastSync)
+		fmt.Fprintf(w, "%s%s\t%s\t%s\t%s\t\n", d.Name, current, d.Fingerprint(), d.Platform, lastSync)
 	}
 	w.Flush()
 
@@ -122,19 +213,30 @@ func runDeviceList(cmd *cobra.Command, args []string) error {
 }
 
 func runDeviceRegister(cmd *cobra.Command, args []string) error {
+	unlock, err := lockWorkspace(cmd)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	info, err := device.GetCurrentDevice()
 	if err != nil {
 		return fmt.Errorf("failed to get device info: %w", err)
 	}
 
-	devicesPath := filepath.Join(".metarepo", "devices.yaml")
+	devicesPath := metarepoPath("devices")
 	registry, err := config.LoadDeviceRegistry(devicesPath)
 	if err != nil {
 		return fmt.Errorf("failed to load device registry: %w", err)
 	}
 
 	// Check if already registered
-	if d := registry.FindDevice(info.Serial); d != nil {
+	if d, migrated := findCurrentDevice(registry, info, true); d != nil {
+		if migrated {
+			if err := registry.Save(devicesPath); err != nil {
+				return fmt.Errorf("failed to save device registry: %w", err)
+			}
+		}
 		return fmt.Errorf("device already registered as '%s'", d.Name)
 	}
 
@@ -143,16 +245,30 @@ func runDeviceRegister(cmd *cobra.Command, args []string) error {
 	if len(args) > 0 {
 		deviceName = args[0]
 	}
+	if err := config.ValidateDeviceName(deviceName); err != nil {
+		return err
+	}
 
-	// Add device
-	registry.AddDevice(info.ToConfigDevice(deviceName))
+	// Add device, with a public key if workspace-config is encrypted
+	d := info.ToConfigDevice(deviceName)
+	if cfg, err := loadConfig(); err == nil && cfg.Sync.Encryption.Enabled {
+		id, created, err := loadOrCreateIdentity(cfg)
+		if err != nil {
+			return err
+		}
+		if created {
+			fmt.Printf("Generated device key: %s\n", identityPath(cfg))
+		}
+		d.PublicKey = id.Recipient().String()
+	}
+	registry.AddDevice(d)
 
 	if err := registry.Save(devicesPath); err != nil {
 		return fmt.Errorf("failed to save device registry: %w", err)
 	}
 
 	// Create workspace-config directory for this device
-	workspaceConfigDir := filepath.Join(".metarepo", "workspace-config", deviceName)
+	workspaceConfigDir := metarepoPath("workspace-config", deviceName)
 	if err := os.MkdirAll(workspaceConfigDir, 0755); err != nil {
 		return fmt.Errorf("failed to create workspace-config directory: %w", err)
 	}
@@ -162,3 +278,440 @@ func runDeviceRegister(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+func runDeviceKey(cmd *cobra.Command, args []string) error {
+	unlock, err := lockWorkspace(cmd)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	cfg, _ := loadConfig()
+
+	id, created, err := loadOrCreateIdentity(cfg)
+	if err != nil {
+		return err
+	}
+	if created {
+		fmt.Printf("Generated device key: %s\n", identityPath(cfg))
+		fmt.Println("Keep this file private; it is never synced.")
+		fmt.Println()
+	}
+	publicKey := id.Recipient().String()
+
+	info, err := device.GetCurrentDevice()
+	if err != nil {
+		return fmt.Errorf("failed to get device info: %w", err)
+	}
+
+	devicesPath := metarepoPath("devices")
+	registry, err := config.LoadDeviceRegistry(devicesPath)
+	if err != nil {
+		return fmt.Errorf("failed to load device registry: %w", err)
+	}
+
+	if d, migrated := findCurrentDevice(registry, info, true); d != nil {
+		added := d.PublicKey != publicKey
+		if added || migrated {
+			d.PublicKey = publicKey
+			if err := registry.Save(devicesPath); err != nil {
+				return fmt.Errorf("failed to save device registry: %w", err)
+			}
+		}
+		if added {
+			fmt.Printf("Added public key to device '%s'\n", d.Name)
+		}
+	} else {
+		fmt.Println("This device is not registered; run 'metarepo device register' to add it as a recipient.")
+	}
+
+	fmt.Printf("Public key: %s\n", publicKey)
+	return nil
+}
+
+func runDeviceAddKey(cmd *cobra.Command, args []string) error {
+	unlock, err := lockWorkspace(cmd)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	name, publicKey := args[0], args[1]
+
+	recipient, err := crypt.ParseRecipient(publicKey)
+	if err != nil {
+		return err
+	}
+
+	devicesPath := metarepoPath("devices")
+	registry, err := config.LoadDeviceRegistry(devicesPath)
+	if err != nil {
+		return fmt.Errorf("failed to load device registry: %w", err)
+	}
+
+	d := registry.FindDeviceByName(name)
+	if d == nil {
+		return fmt.Errorf("device '%s' not found", name)
+	}
+	d.PublicKey = recipient.String()
+
+	if err := registry.Save(devicesPath); err != nil {
+		return fmt.Errorf("failed to save device registry: %w", err)
+	}
+
+	fmt.Printf("Added public key for device '%s'\n", d.Name)
+	fmt.Println("Run 'metarepo push' to re-encrypt workspace-config for it.")
+	return nil
+}
+
+func runDeviceRename(cmd *cobra.Command, args []string) error {
+	unlock, err := lockWorkspace(cmd)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	oldName, newName := args[0], args[1]
+	if err := config.ValidateDeviceName(newName); err != nil {
+		return err
+	}
+
+	devicesPath := metarepoPath("devices")
+	registry, err := config.LoadDeviceRegistry(devicesPath)
+	if err != nil {
+		return fmt.Errorf("failed to load device registry: %w", err)
+	}
+
+	d := registry.FindDeviceByName(oldName)
+	if d == nil {
+		return fmt.Errorf("device '%s' not found", oldName)
+	}
+	if registry.FindDeviceByName(newName) != nil {
+		return fmt.Errorf("device '%s' already exists", newName)
+	}
+
+	oldDir := metarepoPath("workspace-config", oldName)
+	newDir := metarepoPath("workspace-config", newName)
+	if _, err := os.Stat(newDir); err == nil {
+		return fmt.Errorf("%s already exists", newDir)
+	}
+	if err := os.Rename(oldDir, newDir); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to move workspace-config: %w", err)
+	}
+	undoConfig := func() {
+		if err := os.Rename(newDir, oldDir); err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "Warning: failed to move %s back: %v\n", newDir, err)
+		}
+	}
+
+	history := sync.NewHistory(historyDir())
+	if err := history.RenameDevice(oldName, newName); err != nil {
+		undoConfig()
+		return fmt.Errorf("failed to move snapshots: %w", err)
+	}
+
+	undoHistory := func() {
+		if err := history.RenameDevice(newName, oldName); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to move snapshots back: %v\n", err)
+		}
+	}
+
+	if err := renameSyncState(oldName, newName); err != nil {
+		undoHistory()
+		undoConfig()
+		return err
+	}
+
+	d.Name = newName
+	if err := registry.Save(devicesPath); err != nil {
+		if err := renameSyncState(newName, oldName); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to move sync state back: %v\n", err)
+		}
+		undoHistory()
+		undoConfig()
+		return fmt.Errorf("failed to save device registry: %w", err)
+	}
+
+	fmt.Printf("Renamed device '%s' to '%s'\n", oldName, newName)
+	return nil
+}
+
+func runDeviceRemove(cmd *cobra.Command, args []string) error {
+	unlock, err := lockWorkspace(cmd)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	name := args[0]
+
+	devicesPath := metarepoPath("devices")
+	registry, err := config.LoadDeviceRegistry(devicesPath)
+	if err != nil {
+		return fmt.Errorf("failed to load device registry: %w", err)
+	}
+
+	d := registry.FindDeviceByName(name)
+	if d == nil {
+		return fmt.Errorf("device '%s' not found", name)
+	}
+	if !deviceForce {
+		if info, err := device.GetCurrentDevice(); err == nil {
+			if current, _ := findCurrentDevice(registry, info, false); current == d {
+				return fmt.Errorf("'%s' is the current device (use --force to remove it anyway)", name)
+			}
+		}
+	}
+
+	// Save the registry first, so a failed save leaves the device intact
+	registry.RemoveDevice(name)
+	if err := registry.Save(devicesPath); err != nil {
+		return fmt.Errorf("failed to save device registry: %w", err)
+	}
+	archived, err := removeDeviceConfig(name, deviceArchive)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Removed device '%s'\n", name)
+	if archived != "" {
+		fmt.Printf("  Config archived to %s\n", archived)
+	}
+	return nil
+}
+
+func runDevicePrune(cmd *cobra.Command, args []string) error {
+	age, err := parseAge(devicePruneOlderThan)
+	if err != nil {
+		return err
+	}
+
+	if !devicePruneDryRun {
+		unlock, err := lockWorkspace(cmd)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
+	devicesPath := metarepoPath("devices")
+	registry, err := config.LoadDeviceRegistry(devicesPath)
+	if err != nil {
+		return fmt.Errorf("failed to load device registry: %w", err)
+	}
+
+	currentName := ""
+	if info, err := device.GetCurrentDevice(); err == nil {
+		if d, _ := findCurrentDevice(registry, info, false); d != nil {
+			currentName = d.Name
+		}
+	}
+
+	cutoff := time.Now().Add(-age)
+	var stale []config.Device
+	for _, d := range registry.Devices {
+		seen := d.LastSync
+		if seen.IsZero() {
+			seen = d.Registered
+		}
+		if seen.Before(cutoff) && d.Name != currentName {
+			stale = append(stale, d)
+		}
+	}
+
+	if len(stale) == 0 {
+		fmt.Printf("No devices older than %s.\n", devicePruneOlderThan)
+		return nil
+	}
+
+	if devicePruneDryRun {
+		for _, d := range stale {
+			fmt.Printf("  [DRY DEL] %s (%s)\n", d.Name, lastSyncLabel(d))
+		}
+		fmt.Printf("\nWould prune %d device(s)\n", len(stale))
+		return nil
+	}
+
+	// Save the registry first, so a failed save leaves every device intact
+	for _, d := range stale {
+		registry.RemoveDevice(d.Name)
+	}
+	if err := registry.Save(devicesPath); err != nil {
+		return fmt.Errorf("failed to save device registry: %w", err)
+	}
+
+	for _, d := range stale {
+		archived, err := removeDeviceConfig(d.Name, deviceArchive)
+		if err != nil {
+			return err
+		}
+		if archived != "" {
+			fmt.Printf("  [DEL] %s (%s, config archived to %s)\n", d.Name, lastSyncLabel(d), archived)
+		} else {
+			fmt.Printf("  [DEL] %s (%s)\n", d.Name, lastSyncLabel(d))
+		}
+	}
+	fmt.Printf("\nPruned %d device(s)\n", len(stale))
+	return nil
+}
+
+func runDeviceSetCurrent(cmd *cobra.Command, args []string) error {
+	unlock, err := lockWorkspace(cmd)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	name := args[0]
+
+	info, err := device.GetCurrentDevice()
+	if err != nil {
+		return fmt.Errorf("failed to get device info: %w", err)
+	}
+
+	devicesPath := metarepoPath("devices")
+	registry, err := config.LoadDeviceRegistry(devicesPath)
+	if err != nil {
+		return fmt.Errorf("failed to load device registry: %w", err)
+	}
+
+	d := registry.FindDeviceByName(name)
+	if d == nil {
+		return fmt.Errorf("device '%s' not found", name)
+	}
+	if current, migrated := findCurrentDevice(registry, info, true); current != nil {
+		if current.Name == name {
+			if migrated {
+				if err := registry.Save(devicesPath); err != nil {
+					return fmt.Errorf("failed to save device registry: %w", err)
+				}
+			}
+			fmt.Printf("This device is already '%s'\n", name)
+			return nil
+		}
+		return fmt.Errorf("this device is registered as '%s'; run 'metarepo device remove %s --force' first", current.Name, current.Name)
+	}
+
+	d.Serial = info.Serial
+	d.Platform = info.Platform
+	d.Hostname = info.Hostname
+
+	// The old device's key can't decrypt for this one
+	if cfg, err := loadConfig(); err == nil && cfg.Sync.Encryption.Enabled {
+		id, created, err := loadOrCreateIdentity(cfg)
+		if err != nil {
+			return err
+		}
+		if created {
+			fmt.Printf("Generated device key: %s\n", identityPath(cfg))
+		}
+		d.PublicKey = id.Recipient().String()
+	}
+
+	if err := registry.Save(devicesPath); err != nil {
+		return fmt.Errorf("failed to save device registry: %w", err)
+	}
+
+	fmt.Printf("This device is now '%s'\n", name)
+	fmt.Printf("  Serial: %s\n", info.Serial)
+	return nil
+}
+
+// findCurrentDevice returns the registry entry of this device. An entry
+// still held under an identity older versions of metarepo gave the device,
+// such as a VM's machine-id, is moved to its current identity if migrate is
+// set, reporting migrated; the caller saves the registry.
+func findCurrentDevice(registry *config.DeviceRegistry, info *device.Info, migrate bool) (d *config.Device, migrated bool) {
+	if d := registry.FindDevice(info.Serial); d != nil {
+		return d, false
+	}
+	for _, id := range info.PreviousIDs {
+		d := registry.FindDevice(id)
+		if d == nil {
+			continue
+		}
+		if !migrate {
+			fmt.Fprintf(os.Stderr, "Warning: device '%s' is registered under this device's old identity; the next push or pull updates it\n", d.Name)
+			return d, false
+		}
+		d.Serial = info.Serial
+		fmt.Printf("[MIGRATE] Device '%s' is now identified by its %s\n", d.Name, device.SourceDescription(info.Source))
+		return d, true
+	}
+	return nil, false
+}
+
+// currentDeviceName returns the registered name of this device
+func currentDeviceName() (string, error) {
+	info, err := device.GetCurrentDevice()
+	if err != nil {
+		return "", fmt.Errorf("failed to get device info: %w", err)
+	}
+	registry, err := config.LoadDeviceRegistry(metarepoPath("devices"))
+	if err != nil {
+		return "", fmt.Errorf("failed to load device registry: %w", err)
+	}
+	d, _ := findCurrentDevice(registry, info, false)
+	if d == nil {
+		return "", fmt.Errorf("this device is not registered (run 'metarepo device register')")
+	}
+	return d.Name, nil
+}
+
+// removeDeviceConfig deletes a device's workspace-config directory, or moves
+// it to .metarepo/archive/ if archive is set and returns where it went
+func removeDeviceConfig(name string, archive bool) (string, error) {
+	dir := metarepoPath("workspace-config", name)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return "", nil
+	}
+
+	if !archive {
+		if err := os.RemoveAll(dir); err != nil {
+			return "", fmt.Errorf("failed to remove workspace-config: %w", err)
+		}
+		return "", nil
+	}
+
+	dest := metarepoPath("archive", name+"-"+time.Now().Format("20060102-150405"))
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return "", err
+	}
+	if err := os.Rename(dir, dest); err != nil {
+		return "", fmt.Errorf("failed to archive workspace-config: %w", err)
+	}
+	return dest, nil
+}
+
+// lastSyncLabel describes when a device last synced, for prune output
+func lastSyncLabel(d config.Device) string {
+	if d.LastSync.IsZero() {
+		return "never synced"
+	}
+	return "last sync " + d.LastSync.Format("2006-01-02")
+}
+
+// parseAge parses a duration that may also be given in days or weeks, such
+// as 90d or 12w
+func parseAge(s string) (time.Duration, error) {
+	unit := time.Duration(0)
+	switch {
+	case strings.HasSuffix(s, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(s, "w"):
+		unit = 7 * 24 * time.Hour
+	}
+	if unit != 0 {
+		n, err := strconv.Atoi(s[:len(s)-1])
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age %q (use e.g. 90d, 12w or 720h)", s)
+		}
+		return time.Duration(n) * unit, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q (use e.g. 90d, 12w or 720h)", s)
+	}
+	return d, nil
+}
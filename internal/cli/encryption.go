@@ -0,0 +1,171 @@
+package cli
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/JPlanken/metarepo-cli/internal/config"
+	"github.com/JPlanken/metarepo-cli/internal/crypt"
+	"github.com/JPlanken/metarepo-cli/internal/sync"
+)
+
+// identityPath returns the private key file configured in cfg, relative to
+// the workspace root, defaulting to the device-local .metarepo/local/identity.key
+func identityPath(cfg *config.Config) string {
+	if cfg != nil && cfg.Sync.Encryption.Identity != "" {
+		return workspacePath(cfg.Sync.Encryption.Identity)
+	}
+	return metarepoPath("local", "identity.key")
+}
+
+// loadOrCreateIdentity loads this device's private key, generating it on
+// first use. created reports whether a new key was written.
+func loadOrCreateIdentity(cfg *config.Config) (id *crypt.Identity, created bool, err error) {
+	path := identityPath(cfg)
+	id, err = crypt.LoadIdentity(path)
+	if err == nil {
+		return id, false, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, false, fmt.Errorf("failed to load %s: %w", path, err)
+	}
+
+	if id, err = crypt.GenerateIdentity(); err != nil {
+		return nil, false, fmt.Errorf("failed to generate key: %w", err)
+	}
+	if err := id.Save(path); err != nil {
+		return nil, false, fmt.Errorf("failed to save %s: %w", path, err)
+	}
+	return id, true, nil
+}
+
+// decryptor decrypts encrypted workspace-config files, loading the device's
+// private key on first use. Files that aren't encrypted pass through.
+type decryptor struct {
+	path     string
+	identity *crypt.Identity
+}
+
+func newDecryptor(cfg *config.Config) *decryptor {
+	return &decryptor{path: identityPath(cfg)}
+}
+
+func (d *decryptor) decrypt(rel string, data []byte) ([]byte, error) {
+	if !crypt.IsEncrypted(data) {
+		return data, nil
+	}
+
+	if d.identity == nil {
+		id, err := crypt.LoadIdentity(d.path)
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%s is encrypted but this device has no key; run 'metarepo device key' and push from a device that can read it", rel)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s: %w", d.path, err)
+		}
+		d.identity = id
+	}
+
+	plaintext, err := crypt.Decrypt(data, d.identity)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", rel, err)
+	}
+	return plaintext, nil
+}
+
+// encryptor encrypts workspace-config to every device with a public key
+type encryptor struct {
+	identity   *crypt.Identity
+	recipients []*crypt.Recipient
+	tags       []string
+	encrypted  map[string][]byte // ciphertext by destination path and plaintext hash
+}
+
+// newEncryptor creates an encryptor for the registered devices, or returns
+// nil if encryption is disabled. The current device is always a recipient.
+func newEncryptor(cfg *config.Config) (*encryptor, error) {
+	if !cfg.Sync.Encryption.Enabled {
+		return nil, nil
+	}
+
+	id, err := crypt.LoadIdentity(identityPath(cfg))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("encryption is enabled but this device has no key; run 'metarepo device key'")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", identityPath(cfg), err)
+	}
+
+	registry, err := config.LoadDeviceRegistry(metarepoPath("devices"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load device registry: %w", err)
+	}
+
+	e := &encryptor{identity: id, encrypted: map[string][]byte{}}
+	e.add(id.Recipient())
+	for _, d := range registry.Devices {
+		if d.PublicKey == "" {
+			continue
+		}
+		r, err := crypt.ParseRecipient(d.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("device %s: %w", d.Name, err)
+		}
+		e.add(r)
+	}
+	slices.Sort(e.tags)
+
+	return e, nil
+}
+
+// add adds a recipient unless it is already present
+func (e *encryptor) add(r *crypt.Recipient) {
+	if slices.Contains(e.tags, r.Tag()) {
+		return
+	}
+	e.recipients = append(e.recipients, r)
+	e.tags = append(e.tags, r.Tag())
+}
+
+// transform returns the sync transform encrypting files written under dest.
+// A file whose existing copy already holds the same content for the same
+// recipients is left as is, so unchanged files don't show up as updated.
+// Encryption is randomized, so each content is encrypted once and the same
+// ciphertext returned again: the hashes Compare records for the sync state
+// must match the bytes Mirror writes.
+func (e *encryptor) transform(dest string) sync.TransformFunc {
+	if e == nil {
+		return nil
+	}
+	return func(rel string, data []byte) ([]byte, error) {
+		path := filepath.Join(dest, filepath.FromSlash(rel))
+		sum := sha256.Sum256(data)
+		key := path + "\x00" + hex.EncodeToString(sum[:])
+		if ciphertext, ok := e.encrypted[key]; ok {
+			return ciphertext, nil
+		}
+
+		existing, err := os.ReadFile(path)
+		if err == nil && crypt.IsEncrypted(existing) {
+			tags, err := crypt.RecipientTags(existing)
+			if err == nil && slices.Equal(tags, e.tags) {
+				if plaintext, err := crypt.Decrypt(existing, e.identity); err == nil && bytes.Equal(plaintext, data) {
+					e.encrypted[key] = existing
+					return existing, nil
+				}
+			}
+		}
+
+		ciphertext, err := crypt.Encrypt(data, e.recipients)
+		if err != nil {
+			return nil, err
+		}
+		e.encrypted[key] = ciphertext
+		return ciphertext, nil
+	}
+}
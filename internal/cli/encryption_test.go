@@ -0,0 +1,74 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/JPlanken/metarepo-cli/internal/config"
+	"github.com/JPlanken/metarepo-cli/internal/crypt"
+	"github.com/JPlanken/metarepo-cli/internal/sync"
+)
+
+// An encrypted push must record the hash of the ciphertext it wrote, or the
+// next push sees the file as changed on both sides
+func TestEncryptedPushTwice(t *testing.T) {
+	for _, strategy := range []string{"newest", "local", "remote", "manual"} {
+		t.Run(strategy, func(t *testing.T) {
+			root := t.TempDir()
+			oldRoot := workspaceRoot
+			workspaceRoot = root
+			t.Cleanup(func() { workspaceRoot = oldRoot })
+
+			cfg := config.DefaultConfig()
+			cfg.Sync.Encryption.Enabled = true
+			cfg.Sync.Conflict.Strategy = strategy
+			cfg.Sync.Targets = []config.SyncTarget{{Name: "claude", Paths: []string{".claude/"}}}
+
+			id, err := crypt.GenerateIdentity()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := id.Save(identityPath(cfg)); err != nil {
+				t.Fatal(err)
+			}
+
+			local := filepath.Join(root, ".claude", "settings.json")
+			remote := metarepoPath("workspace-config", "laptop")
+			pair := sync.Pair{Local: root, Remote: remote, Push: true}
+
+			for _, content := range []string{`{"theme": "dark"}`, `{"theme": "light"}`} {
+				writeTestFile(t, local, content)
+				if _, err := syncWorkspacePair(cfg, pair, "push/laptop", false); err != nil {
+					t.Fatal(err)
+				}
+
+				data, err := os.ReadFile(filepath.Join(remote, ".claude", "settings.json"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				plaintext, err := crypt.Decrypt(data, id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(plaintext) != content {
+					t.Errorf("pushed %q, want %q", plaintext, content)
+				}
+			}
+
+			if _, err := os.Stat(local + sync.ConflictSuffix); err == nil {
+				t.Errorf("push wrote a conflict copy")
+			}
+		})
+	}
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,168 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/JPlanken/metarepo-cli/internal/git"
+	"github.com/spf13/cobra"
+)
+
+var execCmd = &cobra.Command{
+	Use:   "exec -- <command> [args...]",
+	Short: "Execute a command in all repositories",
+	Long: `Execute a shell command in every repository of the workspace.
+
+The command runs in each repository's directory. Output is collected per
+repository and printed in repository order as soon as it is available. Excluded
+repositories are skipped, and --tag and --not-tag select a subset.
+
+A single argument is run by the shell as written, so it can use pipes and
+globs. Several arguments are quoted, so each reaches the command unchanged.
+
+Examples:
+  metarepo exec -- git status -s
+  metarepo exec -p 8 -- git fetch --all
+  metarepo exec --tag backend -- make test
+  metarepo exec --prefix -- "ls | wc -l"`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runExec,
+}
+
+var (
+	execParallel int
+	execPrefix   bool
+)
+
+func init() {
+	rootCmd.AddCommand(execCmd)
+	execCmd.Flags().IntVarP(&execParallel, "parallel", "p", 1, "number of repositories to run in parallel")
+	execCmd.Flags().BoolVar(&execPrefix, "prefix", false, "prefix each output line with the repository name instead of grouping")
+}
+
+// execResult holds the outcome of running a command in a single repository
+type execResult struct {
+	Repo   *git.RepoInfo
+	Output []byte
+	Err    error
+}
+
+func runExec(cmd *cobra.Command, args []string) error {
+	repos, err := git.ScanForRepos(workspaceRoot)
+	if err != nil {
+		return fmt.Errorf("failed to scan for repositories: %w", err)
+	}
+
+	// Filter excluded repos
+	repos = filterRepos(repos, loadConfigSafe())
+	repos = selectReposByTag(repos)
+
+	if len(repos) == 0 {
+		fmt.Println("No repositories found.")
+		return nil
+	}
+
+	command := shellCommand(args)
+	fmt.Printf("Running '%s' in %d repositories\n\n", command, len(repos))
+
+	results := runOrdered(repos, execParallel, func(repo *git.RepoInfo) execResult {
+		output, err := runShellCommand(repo.AbsPath, command)
+		return execResult{Repo: repo, Output: output, Err: err}
+	}, func(_ *git.RepoInfo, res execResult) {
+		printExecResult(res)
+	})
+	if execPrefix {
+		fmt.Println()
+	}
+
+	var failed []execResult
+	for _, res := range results {
+		if res.Err != nil {
+			failed = append(failed, res)
+		}
+	}
+
+	// Summary
+	fmt.Println("Summary:")
+	fmt.Printf("  Succeeded: %d\n", len(results)-len(failed))
+	if len(failed) > 0 {
+		fmt.Printf("  Failed:    %d\n", len(failed))
+		fmt.Println()
+		fmt.Println("Failed repositories:")
+		for _, res := range failed {
+			fmt.Printf("  %s: %v\n", res.Repo.Name, res.Err)
+		}
+
+		cmd.SilenceUsage = true
+		return fmt.Errorf("command failed in %d of %d repositories", len(failed), len(results))
+	}
+
+	return nil
+}
+
+// printExecResult prints the output of a single repository run
+func printExecResult(res execResult) {
+	output := bytes.TrimRight(res.Output, "\n")
+
+	if execPrefix {
+		scanner := bufio.NewScanner(bytes.NewReader(output))
+		for scanner.Scan() {
+			fmt.Printf("%s | %s\n", res.Repo.Name, scanner.Text())
+		}
+		if res.Err != nil {
+			fmt.Printf("%s | [FAIL] %v\n", res.Repo.Name, res.Err)
+		}
+		return
+	}
+
+	status := "OK"
+	if res.Err != nil {
+		status = "FAILED"
+	}
+	fmt.Printf("==> %s (%s)\n", res.Repo.Name, status)
+	if len(output) > 0 {
+		fmt.Println(string(output))
+	}
+	fmt.Println()
+}
+
+// shellCommand returns the command line for args: a single argument as is,
+// several arguments each quoted for the shell
+func shellCommand(args []string) string {
+	if len(args) == 1 {
+		return args[0]
+	}
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// shellQuote quotes s for the platform shell unless it consists of
+// characters the shell does not interpret
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./=:,+@%") == "" {
+		return s
+	}
+	if runtime.GOOS == "windows" {
+		return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// runShellCommand runs a command through the platform shell in the given directory
+func runShellCommand(dir, command string) ([]byte, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	cmd.Dir = dir
+	return cmd.CombinedOutput()
+}
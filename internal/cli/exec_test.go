@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestShellCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell")
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"single argument runs as written", []string{"ls | wc -l"}, "ls | wc -l"},
+		{"plain arguments", []string{"git", "status", "-s"}, "git status -s"},
+		{"argument with space", []string{"printf", "%s|", "a b", "c"}, "printf '%s|' 'a b' c"},
+		{"argument with quote", []string{"echo", "it's"}, `echo 'it'\''s'`},
+		{"empty argument", []string{"printf", "[%s]", ""}, "printf '[%s]' ''"},
+		{"shell characters", []string{"echo", "$HOME", "*"}, "echo '$HOME' '*'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shellCommand(tt.args); got != tt.want {
+				t.Errorf("shellCommand(%q) = %q, want %q", tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunShellCommandKeepsQuoting(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell")
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"separate arguments", []string{"printf", "%s|", "a b", "c"}, "a b|c|"},
+		{"single command line", []string{`printf '%s|' "a b" c`}, "a b|c|"},
+		{"quote and dollar", []string{"printf", "%s|", "it's", "$HOME"}, "it's|$HOME|"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := runShellCommand(t.TempDir(), shellCommand(tt.args))
+			if err != nil {
+				t.Fatalf("runShellCommand: %v: %s", err, out)
+			}
+			if string(out) != tt.want {
+				t.Errorf("output = %q, want %q", out, tt.want)
+			}
+		})
+	}
+}
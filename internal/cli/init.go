@@ -21,7 +21,7 @@ This will create:
   - .metarepo/ directory with configuration files
   - config.yaml with workspace settings
   - manifest.yaml for repository tracking
-  - devices.yaml for device registry`,
+  - devices/ for the device registry, one file per device`,
 	Args: cobra.MaximumNArgs(1),
 	RunE: runInit,
 }
@@ -85,6 +85,9 @@ func runInit(cmd *cobra.Command, args []string) error {
 	if deviceName == "" {
 		deviceName = deviceInfo.Hostname
 	}
+	if err := config.ValidateDeviceName(deviceName); err != nil {
+		return err
+	}
 
 	// Create .metarepo directory
 	if err := os.MkdirAll(metarepoDir, 0755); err != nil {
@@ -102,7 +105,7 @@ func runInit(cmd *cobra.Command, args []string) error {
 
 	// Create empty manifest
 	manifest := &config.Manifest{
-		Version:      "1.0",
+		Version:      config.ManifestVersion,
 		Repositories: []config.Repository{},
 	}
 	manifestPath := filepath.Join(metarepoDir, "manifest.yaml")
@@ -112,21 +115,28 @@ func runInit(cmd *cobra.Command, args []string) error {
 
 	// Create device registry and register this device
 	registry := &config.DeviceRegistry{
-		Version: "1.0",
+		Version: config.DeviceRegistryVersion,
 	}
 	registry.AddDevice(deviceInfo.ToConfigDevice(deviceName))
 
-	devicesPath := filepath.Join(metarepoDir, "devices.yaml")
+	devicesPath := filepath.Join(metarepoDir, "devices")
 	if err := registry.Save(devicesPath); err != nil {
 		return fmt.Errorf("failed to save device registry: %w", err)
 	}
 
+	// Keep device-local state out of the shared metarepo
+	if err := ensureMetarepoGitignore(metarepoDir); err != nil {
+		return fmt.Errorf("failed to create .gitignore: %w", err)
+	}
+
 	// Create workspace-config directory for per-device configs
 	workspaceConfigDir := filepath.Join(metarepoDir, "workspace-config", deviceName)
 	if err := os.MkdirAll(workspaceConfigDir, 0755); err != nil {
 		return fmt.Errorf("failed to create workspace-config directory: %w", err)
 	}
 
+	registerWorkspace(absRoot, cfg, false)
+
 	fmt.Println()
 	fmt.Println("Workspace initialized successfully!")
 	fmt.Println()
@@ -40,33 +40,50 @@ func init() {
 func runInventoryGenerate(cmd *cobra.Command, args []string) error {
 	fmt.Println("Scanning for repositories...")
 
-	repos, err := git.ScanForRepos(".")
+	repos, err := git.ScanForRepos(workspaceRoot)
 	if err != nil {
 		return fmt.Errorf("failed to scan for repositories: %w", err)
 	}
+	repos = selectReposByTag(repos)
 
 	if len(repos) == 0 {
 		fmt.Println("No repositories found.")
 		return nil
 	}
 
+	// An explicit --output is relative to the current directory
+	output := inventoryOutput
+	if !cmd.Flags().Changed("output") {
+		output = workspacePath(output)
+	}
+
+	if err := writeInventory(repos, output, inventoryFormat); err != nil {
+		return err
+	}
+
+	fmt.Printf("Generated %s with %d repositories.\n", output, len(repos))
+	return nil
+}
+
+// writeInventory writes an inventory of repos to path in the given format
+func writeInventory(repos []*git.RepoInfo, path, format string) error {
 	// Sort by name
-	sort.Slice(repos, func(i, j int) bool {
-		return repos[i].Name < repos[j].Name
+	sorted := make([]*git.RepoInfo, len(repos))
+	copy(sorted, repos)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
 	})
 
 	var content string
-	if inventoryFormat == "simple" {
-		content = generateSimpleInventory(repos)
+	if format == "simple" {
+		content = generateSimpleInventory(sorted)
 	} else {
-		content = generateMarkdownInventory(repos)
+		content = generateMarkdownInventory(sorted)
 	}
 
-	if err := os.WriteFile(inventoryOutput, []byte(content), 0644); err != nil {
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
 		return fmt.Errorf("failed to write inventory: %w", err)
 	}
-
-	fmt.Printf("Generated %s with %d repositories.\n", inventoryOutput, len(repos))
 	return nil
 }
 
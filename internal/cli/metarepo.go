@@ -0,0 +1,185 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/JPlanken/metarepo-cli/internal/config"
+	"github.com/JPlanken/metarepo-cli/internal/fsutil"
+	"github.com/JPlanken/metarepo-cli/internal/git"
+)
+
+// metarepoRemote is the git remote name used for the metarepo itself
+const metarepoRemote = "origin"
+
+// metarepoBranch returns the branch the metarepo is synced on
+func metarepoBranch(cfg *config.Config) string {
+	if cfg.Sync.Branch == "" {
+		return "main"
+	}
+	return cfg.Sync.Branch
+}
+
+// pushMetarepo commits all changes in .metarepo/ with a device-stamped
+// message, rebases them onto the commits other devices pushed and pushes
+// them to the configured sync remote. The metarepo is initialized as a git
+// repository on first use.
+func pushMetarepo(cfg *config.Config, deviceName string) error {
+	metarepoDir := metarepoPath()
+	branch := metarepoBranch(cfg)
+
+	if !git.IsGitRepo(metarepoDir) {
+		if cfg.Sync.Remote == "" {
+			return fmt.Errorf("no sync.remote configured")
+		}
+		if err := git.Init(metarepoDir, branch); err != nil {
+			return fmt.Errorf("failed to initialize metarepo: %w", err)
+		}
+	}
+
+	if cfg.Sync.Remote != "" {
+		if err := git.SetRemote(metarepoDir, metarepoRemote, cfg.Sync.Remote); err != nil {
+			return fmt.Errorf("failed to set metarepo remote: %w", err)
+		}
+	}
+
+	if err := ensureMetarepoGitignore(metarepoDir); err != nil {
+		return fmt.Errorf("failed to update .gitignore: %w", err)
+	}
+
+	message := fmt.Sprintf("Sync from %s at %s", deviceName, time.Now().Format("2006-01-02 15:04:05"))
+	committed, err := git.CommitAll(metarepoDir, message)
+	if err != nil {
+		return fmt.Errorf("failed to commit metarepo: %w", err)
+	}
+	if committed {
+		fmt.Printf("  [COMMIT] %s\n", message)
+	} else {
+		fmt.Println("  [COMMIT] nothing to commit")
+	}
+
+	fmt.Printf("  [REBASE] onto %s (%s)... ", metarepoRemote, branch)
+	rebased, err := git.Rebase(metarepoDir, metarepoRemote, branch)
+	if err != nil {
+		fmt.Println("FAILED")
+		return fmt.Errorf("failed to rebase onto the remote metarepo, resolve in %s: %w", metarepoDir, err)
+	}
+	if rebased {
+		fmt.Println("OK")
+	} else {
+		fmt.Println("up to date")
+	}
+
+	fmt.Printf("  [PUSH] metarepo → %s (%s)... ", cfg.Sync.Remote, branch)
+	if err := git.PushBranch(metarepoDir, metarepoRemote, branch); err != nil {
+		fmt.Println("FAILED")
+		return err
+	}
+	fmt.Println("OK")
+
+	return nil
+}
+
+// pullMetarepo fetches the metarepo from its remote and fast-forwards it,
+// failing if it has commits that were not pushed yet and the remote moved
+// on. A metarepo that is not a git repository yet is initialized and the
+// remote's history checked out, replacing the files it also has.
+func pullMetarepo(cfg *config.Config) error {
+	metarepoDir := metarepoPath()
+	branch := metarepoBranch(cfg)
+
+	initialized := false
+	if !git.IsGitRepo(metarepoDir) {
+		if cfg.Sync.Remote == "" {
+			return fmt.Errorf("%s is not a git repository", metarepoDir)
+		}
+		if err := git.Init(metarepoDir, branch); err != nil {
+			return fmt.Errorf("failed to initialize metarepo: %w", err)
+		}
+		initialized = true
+	}
+
+	if cfg.Sync.Remote != "" {
+		if err := git.SetRemote(metarepoDir, metarepoRemote, cfg.Sync.Remote); err != nil {
+			return fmt.Errorf("failed to set metarepo remote: %w", err)
+		}
+	}
+
+	fmt.Printf("  [PULL] metarepo (%s)... ", branch)
+	var updated bool
+	var err error
+	if initialized {
+		updated, err = git.CheckoutRemote(metarepoDir, metarepoRemote, branch)
+	} else {
+		updated, err = git.FastForward(metarepoDir, metarepoRemote, branch)
+	}
+	if errors.Is(err, git.ErrDiverged) {
+		fmt.Println("FAILED")
+		return fmt.Errorf("%w; run 'metarepo push' to rebase unpushed metarepo commits onto it", err)
+	}
+	if err != nil {
+		fmt.Println("FAILED")
+		return err
+	}
+	if updated {
+		fmt.Println("updated")
+	} else {
+		fmt.Println("up to date")
+	}
+
+	return nil
+}
+
+// metarepoIgnored lists device-local entries that must never be pushed
+var metarepoIgnored = []string{"local/"}
+
+// ensureMetarepoGitignore makes sure the metarepo's .gitignore excludes
+// device-local state
+func ensureMetarepoGitignore(metarepoDir string) error {
+	path := filepath.Join(metarepoDir, ".gitignore")
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	lines := strings.Split(string(data), "\n")
+	content := strings.TrimRight(string(data), "\n")
+	changed := false
+	for _, entry := range metarepoIgnored {
+		if !slices.Contains(lines, entry) {
+			if content != "" {
+				content += "\n"
+			}
+			content += entry
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	return fsutil.WriteFile(path, []byte(content+"\n"), 0644)
+}
+
+// updateInventory regenerates the inventory file configured in cfg. It is
+// written inside .metarepo/ so the metarepo commit includes it.
+func updateInventory(cfg *config.Config, repos []*git.RepoInfo) (string, error) {
+	output := cfg.Inventory.Output
+	if output == "" {
+		output = "REPOS.md"
+	}
+	if !filepath.IsLocal(output) {
+		return "", fmt.Errorf("inventory.output must be a relative path inside .metarepo/: %s", output)
+	}
+	output = metarepoPath(filepath.Clean(output))
+
+	if err := writeInventory(repos, output, "markdown"); err != nil {
+		return "", err
+	}
+	return output, nil
+}
@@ -0,0 +1,140 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/JPlanken/metarepo-cli/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Upgrade workspace files to the current schema version",
+	Long: `Upgrade .metarepo/config.yaml, manifest.yaml and the device registry to the
+schema versions this metarepo writes. Older files are also upgraded in memory
+whenever they are loaded; migrate writes the result back, keeping comments.
+
+A single-file devices.yaml is split into devices/, one file per device.
+
+Files written by a newer metarepo are never changed.`,
+	Args: cobra.NoArgs,
+	RunE: runMigrate,
+}
+
+var migrateDryRun bool
+
+func init() {
+	rootCmd.AddCommand(migrateCmd)
+	migrateCmd.Flags().BoolVar(&migrateDryRun, "dry-run", false, "show the migrations without writing anything")
+}
+
+func runMigrate(cmd *cobra.Command, args []string) error {
+	if !config.IsWorkspace(workspaceRoot) {
+		return config.ErrNoWorkspace
+	}
+	if !migrateDryRun {
+		unlock, err := lockWorkspace(cmd)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
+	if migrateDryRun {
+		fmt.Println("Migrating workspace files (dry run)...")
+	} else {
+		fmt.Println("Migrating workspace files...")
+	}
+
+	migrated, current, failed := 0, 0, 0
+	tag := "[MIGRATE]"
+	if migrateDryRun {
+		tag = "[DRY MIGRATE]"
+	}
+
+	files := []schemaFile{
+		{"config.yaml", config.ConfigSchema},
+		{"manifest.yaml", config.ManifestSchema},
+	}
+
+	// Bring the registry's layout and serial hashes up to date first
+	devicesDir := metarepoPath("devices")
+	if changes, err := migrateDeviceRegistry(devicesDir, migrateDryRun); err != nil {
+		fmt.Printf("  [FAIL] device registry: %v\n", err)
+		failed++
+	} else if len(changes) > 0 {
+		fmt.Printf("  %s device registry\n", tag)
+		for _, change := range changes {
+			fmt.Printf("      %s\n", change)
+		}
+		migrated++
+	}
+	entries, err := os.ReadDir(devicesDir)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read device registry: %w", err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && filepath.Ext(entry.Name()) == ".yaml" {
+			files = append(files, schemaFile{filepath.Join("devices", entry.Name()), config.DeviceSchema})
+		}
+	}
+
+	for _, f := range files {
+		path := metarepoPath(f.name)
+		from, applied, err := f.schema.MigrateFile(path, migrateDryRun)
+		switch {
+		case os.IsNotExist(err):
+			fmt.Printf("  [SKIP] %s (not found)\n", f.name)
+		case err != nil:
+			fmt.Printf("  [FAIL] %s: %v\n", f.name, err)
+			failed++
+		case len(applied) == 0:
+			fmt.Printf("  [OK] %s (version %s)\n", filepath.ToSlash(f.name), f.schema.Version)
+			current++
+		default:
+			fmt.Printf("  %s %s: %s → %s\n", tag, filepath.ToSlash(f.name), from, f.schema.Version)
+			for _, m := range applied {
+				fmt.Printf("      %s → %s: %s\n", m.From, m.To, m.Description)
+			}
+			migrated++
+		}
+	}
+
+	fmt.Println()
+	fmt.Println("Summary:")
+	if migrateDryRun {
+		fmt.Printf("  Would migrate: %d\n", migrated)
+	} else {
+		fmt.Printf("  Migrated:      %d\n", migrated)
+	}
+	fmt.Printf("  Up to date:    %d\n", current)
+	if failed > 0 {
+		fmt.Printf("  Errors:        %d\n", failed)
+		return fmt.Errorf("%d file(s) could not be migrated", failed)
+	}
+	return nil
+}
+
+// schemaFile is a file in .metarepo and the schema it follows
+type schemaFile struct {
+	name   string
+	schema *config.Schema
+}
+
+// migrateDeviceRegistry rewrites a device registry read from an older
+// format and returns the changes made
+func migrateDeviceRegistry(dir string, dryRun bool) ([]string, error) {
+	registry, err := config.LoadDeviceRegistry(dir)
+	if err != nil {
+		return nil, err
+	}
+	changes := registry.Migrations()
+	if len(changes) > 0 && !dryRun {
+		if err := registry.Save(dir); err != nil {
+			return nil, err
+		}
+	}
+	return changes, nil
+}
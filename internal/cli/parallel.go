@@ -0,0 +1,84 @@
+package cli
+
+// opStatus is the outcome of an operation on a single repository
+type opStatus int
+
+const (
+	opOK opStatus = iota
+	opSkipped
+	opFailed
+	opDryRun
+)
+
+// opResult holds the outcome of an operation on a single repository
+type opResult struct {
+	Name   string
+	Status opStatus
+	Reason string // why the repo was skipped, or what a dry run would do
+	Err    error
+}
+
+// opSummary holds the per-status counts of a set of results
+type opSummary struct {
+	OK      int
+	Skipped int
+	Failed  int
+	DryRun  int
+}
+
+// summarizeResults counts results by status
+func summarizeResults(results []opResult) opSummary {
+	var s opSummary
+	for _, r := range results {
+		switch r.Status {
+		case opOK:
+			s.OK++
+		case opSkipped:
+			s.Skipped++
+		case opFailed:
+			s.Failed++
+		case opDryRun:
+			s.DryRun++
+		}
+	}
+	return s
+}
+
+// runOrdered runs work for every item using at most workers goroutines.
+// report is called on the calling goroutine for each result in input order,
+// as soon as that result and all results before it are available, so output
+// stays ordered while work proceeds concurrently. The collected results are
+// returned in input order.
+func runOrdered[T, R any](items []T, workers int, work func(T) R, report func(T, R)) []R {
+	if workers < 1 {
+		workers = 1
+	}
+
+	results := make([]R, len(items))
+	done := make([]chan struct{}, len(items))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+
+	sem := make(chan struct{}, workers)
+
+	go func() {
+		for i, item := range items {
+			sem <- struct{}{}
+			go func(i int, item T) {
+				defer func() { <-sem }()
+				results[i] = work(item)
+				close(done[i])
+			}(i, item)
+		}
+	}()
+
+	for i, item := range items {
+		<-done[i]
+		if report != nil {
+			report(item, results[i])
+		}
+	}
+
+	return results
+}
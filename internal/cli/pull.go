@@ -3,12 +3,11 @@ package cli
 import (
 	"fmt"
 	"os"
-	"os/exec"
-	"path/filepath"
 
 	"github.com/JPlanken/metarepo-cli/internal/config"
 	"github.com/JPlanken/metarepo-cli/internal/device"
 	"github.com/JPlanken/metarepo-cli/internal/git"
+	"github.com/JPlanken/metarepo-cli/internal/sync"
 	"github.com/spf13/cobra"
 )
 
@@ -18,7 +17,8 @@ var pullCmd = &cobra.Command{
 	Long: `Pull all repositories from their remotes and sync workspace configuration.
 
 This command will:
-  1. Pull the metarepo to get latest state
+  1. Pull the metarepo to get latest state, fast-forward only; a metarepo
+     that is not a git repository yet is checked out from sync.remote
   2. Clone any new repositories found in manifest
   3. Pull all existing repositories
   4. Optionally sync workspace configuration from another device`,
@@ -26,9 +26,11 @@ This command will:
 }
 
 var (
-	pullDryRun     bool
-	pullSkipConfig bool
-	pullFromDevice string
+	pullDryRun       bool
+	pullSkipConfig   bool
+	pullFromDevice   string
+	pullParallel     int
+	pullSkipMetarepo bool
 )
 
 func init() {
@@ -36,17 +38,43 @@ func init() {
 	pullCmd.Flags().BoolVar(&pullDryRun, "dry-run", false, "show what would be pulled without actually pulling")
 	pullCmd.Flags().BoolVar(&pullSkipConfig, "skip-config", false, "skip syncing workspace configuration")
 	pullCmd.Flags().StringVar(&pullFromDevice, "from", "", "sync config from specific device")
+	pullCmd.Flags().BoolVar(&pullSkipMetarepo, "skip-metarepo", false, "skip pulling the metarepo itself")
+	pullCmd.Flags().IntVarP(&pullParallel, "parallel", "p", 1, "number of repositories to pull in parallel")
 }
 
 func runPull(cmd *cobra.Command, args []string) error {
+	if !pullDryRun {
+		unlock, err := lockWorkspace(cmd)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
 	// Get device info
 	deviceInfo, err := device.GetCurrentDevice()
 	if err != nil {
 		return fmt.Errorf("failed to get device info: %w", err)
 	}
 
+	// Load config for exclude filtering and sync settings
+	cfg, _ := loadConfig()
+
+	// Pull the metarepo first so the manifest and registry are current
+	if cfg != nil && cfg.Sync.Enabled && !pullSkipMetarepo && (cfg.Sync.Remote != "" || git.IsGitRepo(metarepoPath())) {
+		fmt.Println("Pulling metarepo...")
+		if pullDryRun {
+			fmt.Println("  [DRY] Would pull metarepo")
+		} else if err := pullMetarepo(cfg); err != nil {
+			fmt.Printf("Warning: Failed to pull metarepo: %v\n", err)
+		} else if updated, err := loadConfig(); err == nil {
+			cfg = updated
+		}
+		fmt.Println()
+	}
+
 	// Load device registry to get device name
-	devicesPath := filepath.Join(".metarepo", "devices.yaml")
+	devicesPath := metarepoPath("devices")
 	registry, err := config.LoadDeviceRegistry(devicesPath)
 	if err != nil {
 		fmt.Println("Warning: Could not load device registry")
@@ -54,53 +82,32 @@ func runPull(cmd *cobra.Command, args []string) error {
 
 	deviceName := deviceInfo.Hostname
 	if registry != nil {
-		if d := registry.FindDevice(deviceInfo.Serial); d != nil {
+		if d, _ := findCurrentDevice(registry, deviceInfo, !pullDryRun); d != nil {
 			deviceName = d.Name
 		}
 	}
 
 	fmt.Printf("Pulling to device: %s (%s)\n\n", deviceName, deviceInfo.Serial)
 
-	// Load config for exclude filtering
-	configPath := filepath.Join(".metarepo", "config.yaml")
-	cfg, _ := config.Load(configPath)
-
 	// Load manifest to check for new repos
-	manifestPath := filepath.Join(".metarepo", "manifest.yaml")
+	manifestPath := metarepoPath("manifest.yaml")
 	manifest, _ := config.LoadManifest(manifestPath)
 
 	// Clone new repos from manifest
 	if manifest != nil && len(manifest.Repositories) > 0 {
 		fmt.Println("Checking for new repositories...")
-		newCount := 0
 
-		for _, repo := range manifest.Repositories {
-			repoPath := repo.Path
-			if repoPath == "" {
-				repoPath = repo.Name
-			}
-
-			if _, err := os.Stat(repoPath); os.IsNotExist(err) {
-				if repo.URL == "" {
-					continue
-				}
-
-				if pullDryRun {
-					fmt.Printf("  [DRY] Would clone: %s\n", repo.Name)
-					newCount++
-					continue
-				}
-
-				fmt.Printf("  [CLONE] %s... ", repo.Name)
-				if err := git.Clone(repo.URL, repoPath); err != nil {
-					fmt.Println("FAILED")
-				} else {
-					fmt.Println("OK")
-					newCount++
-				}
+		var missing []config.Repository
+		for _, repo := range selectManifestByTag(manifest.Repositories) {
+			if _, err := os.Stat(workspacePath(repo.LocalPath())); os.IsNotExist(err) && repo.URL != "" {
+				missing = append(missing, repo)
 			}
 		}
 
+		results := runOrdered(missing, pullParallel, cloneMissingRepo, printPullCloneResult)
+		summary := summarizeResults(results)
+		newCount := summary.OK + summary.DryRun
+
 		if newCount > 0 {
 			fmt.Printf("Cloned %d new repositories\n", newCount)
 		} else {
@@ -110,7 +117,7 @@ func runPull(cmd *cobra.Command, args []string) error {
 	}
 
 	// Scan for existing repositories
-	repos, err := git.ScanForRepos(".")
+	repos, err := git.ScanForRepos(workspaceRoot)
 	if err != nil {
 		return fmt.Errorf("failed to scan for repositories: %w", err)
 	}
@@ -127,54 +134,26 @@ func runPull(cmd *cobra.Command, args []string) error {
 		}
 		repos = filtered
 	}
+	repos = selectReposByTag(repos)
 
 	// Pull all repos
 	fmt.Printf("Pulling %d repositories\n\n", len(repos))
 
-	pulledCount := 0
-	skippedCount := 0
-	errorCount := 0
-
-	for _, repo := range repos {
-		// Skip repos without remote
-		if !repo.HasRemote {
-			fmt.Printf("  [SKIP] %s (no remote)\n", repo.Name)
-			skippedCount++
-			continue
-		}
-
-		// Skip detached HEAD
-		if repo.IsDetached {
-			fmt.Printf("  [SKIP] %s (detached HEAD)\n", repo.Name)
-			skippedCount++
-			continue
-		}
-
-		if pullDryRun {
-			fmt.Printf("  [DRY] %s (would pull)\n", repo.Name)
-			continue
-		}
-
-		fmt.Printf("  [PULL] %s... ", repo.Name)
-
-		if err := git.Pull(repo.AbsPath); err != nil {
-			fmt.Println("FAILED")
-			errorCount++
-		} else {
-			fmt.Println("OK")
-			pulledCount++
-		}
-	}
+	results := runOrdered(repos, pullParallel, pullRepo, printPullResult)
+	summary := summarizeResults(results)
 
 	fmt.Println()
 
 	// Sync workspace config from another device
-	if !pullSkipConfig && !pullDryRun && pullFromDevice != "" {
+	if !pullSkipConfig && pullFromDevice != "" {
 		fmt.Printf("Syncing workspace configuration from %s...\n", pullFromDevice)
-		if err := pullWorkspaceConfig(pullFromDevice, deviceName); err != nil {
+		if changes, err := pullWorkspaceConfig(pullFromDevice, deviceName, pullDryRun); err != nil {
 			fmt.Printf("Warning: Failed to sync config: %v\n", err)
 		} else {
-			fmt.Println("Workspace configuration synced.")
+			printChangeSet(changes, pullDryRun)
+			if !pullDryRun {
+				fmt.Println("Workspace configuration synced.")
+			}
 		}
 		fmt.Println()
 	}
@@ -184,61 +163,96 @@ func runPull(cmd *cobra.Command, args []string) error {
 		registry.UpdateLastSync(deviceInfo.Serial)
 		registry.Save(devicesPath)
 	}
+	if !pullDryRun {
+		registerWorkspace(workspaceRoot, cfg, true)
+	}
 
 	// Summary
 	fmt.Println("Summary:")
-	fmt.Printf("  Pulled:  %d\n", pulledCount)
-	fmt.Printf("  Skipped: %d\n", skippedCount)
-	if errorCount > 0 {
-		fmt.Printf("  Errors:  %d\n", errorCount)
+	fmt.Printf("  Pulled:  %d\n", summary.OK)
+	fmt.Printf("  Skipped: %d\n", summary.Skipped)
+	if summary.Failed > 0 {
+		fmt.Printf("  Errors:  %d\n", summary.Failed)
 	}
 
 	return nil
 }
 
+// cloneMissingRepo clones a manifest repository that is missing locally
+func cloneMissingRepo(repo config.Repository) opResult {
+	if pullDryRun {
+		return opResult{Name: repo.Name, Status: opDryRun}
+	}
+
+	if err := git.CloneQuiet(repo.URL, workspacePath(repo.LocalPath())); err != nil {
+		return opResult{Name: repo.Name, Status: opFailed, Err: err}
+	}
+	return opResult{Name: repo.Name, Status: opOK}
+}
+
+func printPullCloneResult(repo config.Repository, res opResult) {
+	switch res.Status {
+	case opDryRun:
+		fmt.Printf("  [DRY] Would clone: %s\n", res.Name)
+	case opFailed:
+		fmt.Printf("  [CLONE] %s... FAILED (%v)\n", res.Name, res.Err)
+	default:
+		fmt.Printf("  [CLONE] %s... OK\n", res.Name)
+	}
+}
+
+// pullRepo pulls a single repository
+func pullRepo(repo *git.RepoInfo) opResult {
+	// Skip repos without remote
+	if !repo.HasRemote {
+		return opResult{Name: repo.Name, Status: opSkipped, Reason: "no remote"}
+	}
+
+	// Skip detached HEAD
+	if repo.IsDetached {
+		return opResult{Name: repo.Name, Status: opSkipped, Reason: "detached HEAD"}
+	}
+
+	if pullDryRun {
+		return opResult{Name: repo.Name, Status: opDryRun, Reason: "would pull"}
+	}
+
+	if err := git.Pull(repo.AbsPath); err != nil {
+		return opResult{Name: repo.Name, Status: opFailed, Err: err}
+	}
+	return opResult{Name: repo.Name, Status: opOK}
+}
+
+func printPullResult(repo *git.RepoInfo, res opResult) {
+	switch res.Status {
+	case opSkipped:
+		fmt.Printf("  [SKIP] %s (%s)\n", res.Name, res.Reason)
+	case opDryRun:
+		fmt.Printf("  [DRY] %s (%s)\n", res.Name, res.Reason)
+	case opFailed:
+		fmt.Printf("  [PULL] %s... FAILED (%v)\n", res.Name, res.Err)
+	default:
+		fmt.Printf("  [PULL] %s... OK\n", res.Name)
+	}
+}
+
 // pullWorkspaceConfig syncs IDE configs from another device's workspace-config
-func pullWorkspaceConfig(fromDevice, toDevice string) error {
-	srcDir := filepath.Join(".metarepo", "workspace-config", fromDevice)
+func pullWorkspaceConfig(fromDevice, toDevice string, dryRun bool) (*sync.ChangeSet, error) {
+	srcDir := metarepoPath("workspace-config", fromDevice)
 	if _, err := os.Stat(srcDir); os.IsNotExist(err) {
-		return fmt.Errorf("no configuration found for device: %s", fromDevice)
+		return nil, fmt.Errorf("no configuration found for device: %s", fromDevice)
 	}
 
-	configPath := filepath.Join(".metarepo", "config.yaml")
-	cfg, err := config.Load(configPath)
+	cfg, err := loadConfig()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Sync each IDE config back to the workspace root
-	syncPaths := []string{}
-	syncPaths = append(syncPaths, cfg.Sync.IDE.Cursor...)
-	syncPaths = append(syncPaths, cfg.Sync.IDE.Claude...)
-	syncPaths = append(syncPaths, cfg.Sync.IDE.VSCode...)
-
-	for _, destPath := range syncPaths {
-		srcPath := filepath.Join(srcDir, destPath)
-		if _, err := os.Stat(srcPath); os.IsNotExist(err) {
-			continue
-		}
-
-		// Ensure destination directory exists
-		if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
-			return err
-		}
-
-		// Use rsync for syncing
-		cmd := exec.Command("rsync", "-a", "--delete",
-			"--exclude", ".git/",
-			"--exclude", "node_modules/",
-			"--exclude", ".venv/",
-			"--exclude", "venv/",
-			"--exclude", "__pycache__/",
-			"--exclude", ".DS_Store",
-			srcPath, destPath)
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("failed to sync %s: %w", destPath, err)
-		}
+	pair := sync.Pair{
+		Local:  workspaceRoot,
+		Remote: srcDir,
+		Push:   false,
 	}
-
-	return nil
+	return syncWorkspacePair(cfg, pair, "pull/"+fromDevice, dryRun)
 }
@@ -2,13 +2,11 @@ package cli
 
 import (
 	"fmt"
-	"os"
-	"os/exec"
-	"path/filepath"
 
 	"github.com/JPlanken/metarepo-cli/internal/config"
 	"github.com/JPlanken/metarepo-cli/internal/device"
 	"github.com/JPlanken/metarepo-cli/internal/git"
+	"github.com/JPlanken/metarepo-cli/internal/sync"
 	"github.com/spf13/cobra"
 )
 
@@ -21,22 +19,35 @@ This command will:
   1. Push all repositories with uncommitted changes
   2. Sync workspace configuration (IDE settings, etc.)
   3. Update the repository inventory (REPOS.md)
-  4. Commit and push the metarepo itself`,
+  4. Commit the metarepo, rebase it onto changes pushed from other devices
+     and push it`,
 	RunE: runPush,
 }
 
 var (
-	pushDryRun     bool
-	pushSkipConfig bool
+	pushDryRun       bool
+	pushSkipConfig   bool
+	pushParallel     int
+	pushSkipMetarepo bool
 )
 
 func init() {
 	rootCmd.AddCommand(pushCmd)
 	pushCmd.Flags().BoolVar(&pushDryRun, "dry-run", false, "show what would be pushed without actually pushing")
 	pushCmd.Flags().BoolVar(&pushSkipConfig, "skip-config", false, "skip syncing workspace configuration")
+	pushCmd.Flags().BoolVar(&pushSkipMetarepo, "skip-metarepo", false, "skip updating the inventory and pushing the metarepo itself")
+	pushCmd.Flags().IntVarP(&pushParallel, "parallel", "p", 1, "number of repositories to push in parallel")
 }
 
 func runPush(cmd *cobra.Command, args []string) error {
+	if !pushDryRun {
+		unlock, err := lockWorkspace(cmd)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
 	// Get device info
 	deviceInfo, err := device.GetCurrentDevice()
 	if err != nil {
@@ -44,7 +55,7 @@ func runPush(cmd *cobra.Command, args []string) error {
 	}
 
 	// Load device registry to get device name
-	devicesPath := filepath.Join(".metarepo", "devices.yaml")
+	devicesPath := metarepoPath("devices")
 	registry, err := config.LoadDeviceRegistry(devicesPath)
 	if err != nil {
 		fmt.Println("Warning: Could not load device registry")
@@ -52,7 +63,7 @@ func runPush(cmd *cobra.Command, args []string) error {
 
 	deviceName := deviceInfo.Hostname
 	if registry != nil {
-		if d := registry.FindDevice(deviceInfo.Serial); d != nil {
+		if d, _ := findCurrentDevice(registry, deviceInfo, !pushDryRun); d != nil {
 			deviceName = d.Name
 		}
 	}
@@ -60,14 +71,14 @@ func runPush(cmd *cobra.Command, args []string) error {
 	fmt.Printf("Pushing from device: %s (%s)\n\n", deviceName, deviceInfo.Serial)
 
 	// Load config for exclude filtering
-	configPath := filepath.Join(".metarepo", "config.yaml")
-	cfg, _ := config.Load(configPath)
+	cfg, _ := loadConfig()
 
 	// Scan for repositories
-	repos, err := git.ScanForRepos(".")
+	allRepos, err := git.ScanForRepos(workspaceRoot)
 	if err != nil {
 		return fmt.Errorf("failed to scan for repositories: %w", err)
 	}
+	repos := allRepos
 
 	// Filter excluded repos
 	if cfg != nil && len(cfg.Repos.Exclude) > 0 {
@@ -81,58 +92,31 @@ func runPush(cmd *cobra.Command, args []string) error {
 		}
 		repos = filtered
 	}
+	repos = selectReposByTag(repos)
 
 	// Push all repos
 	fmt.Printf("Found %d repositories\n\n", len(repos))
 
-	pushedCount := 0
-	skippedCount := 0
-	errorCount := 0
-
-	for _, repo := range repos {
-		// Skip repos without remote
-		if !repo.HasRemote {
-			fmt.Printf("  [SKIP] %s (no remote)\n", repo.Name)
-			skippedCount++
-			continue
-		}
-
-		// Skip detached HEAD
-		if repo.IsDetached {
-			fmt.Printf("  [SKIP] %s (detached HEAD)\n", repo.Name)
-			skippedCount++
-			continue
-		}
-
-		if pushDryRun {
-			status := "would push"
-			if !repo.HasChanges {
-				status = "no changes"
-			}
-			fmt.Printf("  [DRY] %s (%s)\n", repo.Name, status)
-			continue
-		}
-
-		fmt.Printf("  [PUSH] %s... ", repo.Name)
-
-		if err := git.Push(repo.AbsPath); err != nil {
-			fmt.Println("FAILED")
-			errorCount++
-		} else {
-			fmt.Println("OK")
-			pushedCount++
-		}
-	}
+	results := runOrdered(repos, pushParallel, pushRepo, printPushResult)
+	summary := summarizeResults(results)
 
 	fmt.Println()
 
 	// Sync workspace config
-	if !pushSkipConfig && !pushDryRun {
+	if !pushSkipConfig {
 		fmt.Println("Syncing workspace configuration...")
-		if err := syncWorkspaceConfig(deviceName); err != nil {
+		if changes, err := syncWorkspaceConfig(deviceName, pushDryRun); err != nil {
 			fmt.Printf("Warning: Failed to sync config: %v\n", err)
 		} else {
-			fmt.Println("Workspace configuration synced.")
+			printChangeSet(changes, pushDryRun)
+			if !pushDryRun {
+				fmt.Println("Workspace configuration synced.")
+				if snap, err := recordSnapshot(deviceName); err != nil {
+					fmt.Printf("Warning: Failed to record snapshot: %v\n", err)
+				} else if snap != nil {
+					fmt.Printf("Recorded snapshot %s\n", snap.ID)
+				}
+			}
 		}
 		fmt.Println()
 	}
@@ -142,59 +126,88 @@ func runPush(cmd *cobra.Command, args []string) error {
 		registry.UpdateLastSync(deviceInfo.Serial)
 		registry.Save(devicesPath)
 	}
+	if !pushDryRun {
+		registerWorkspace(workspaceRoot, cfg, true)
+	}
+
+	// Update the inventory and push the metarepo itself
+	if cfg != nil && !pushDryRun && !pushSkipMetarepo {
+		if output, err := updateInventory(cfg, allRepos); err != nil {
+			fmt.Printf("Warning: Failed to update inventory: %v\n", err)
+		} else {
+			fmt.Printf("Updated inventory: %s\n", output)
+		}
+
+		if cfg.Sync.Enabled {
+			fmt.Println("Pushing metarepo...")
+			if err := pushMetarepo(cfg, deviceName); err != nil {
+				fmt.Printf("Warning: Failed to push metarepo: %v\n", err)
+			}
+		}
+		fmt.Println()
+	}
 
 	// Summary
 	fmt.Println("Summary:")
-	fmt.Printf("  Pushed:  %d\n", pushedCount)
-	fmt.Printf("  Skipped: %d\n", skippedCount)
-	if errorCount > 0 {
-		fmt.Printf("  Errors:  %d\n", errorCount)
+	fmt.Printf("  Pushed:  %d\n", summary.OK)
+	fmt.Printf("  Skipped: %d\n", summary.Skipped)
+	if summary.Failed > 0 {
+		fmt.Printf("  Errors:  %d\n", summary.Failed)
 	}
 
 	return nil
 }
 
-// syncWorkspaceConfig syncs IDE configs to the workspace-config directory
-func syncWorkspaceConfig(deviceName string) error {
-	configPath := filepath.Join(".metarepo", "config.yaml")
-	cfg, err := config.Load(configPath)
-	if err != nil {
-		return err
+// pushRepo pushes a single repository
+func pushRepo(repo *git.RepoInfo) opResult {
+	// Skip repos without remote
+	if !repo.HasRemote {
+		return opResult{Name: repo.Name, Status: opSkipped, Reason: "no remote"}
 	}
 
-	destDir := filepath.Join(".metarepo", "workspace-config", deviceName)
-
-	// Sync each IDE config
-	syncPaths := []string{}
-	syncPaths = append(syncPaths, cfg.Sync.IDE.Cursor...)
-	syncPaths = append(syncPaths, cfg.Sync.IDE.Claude...)
-	syncPaths = append(syncPaths, cfg.Sync.IDE.VSCode...)
+	// Skip detached HEAD
+	if repo.IsDetached {
+		return opResult{Name: repo.Name, Status: opSkipped, Reason: "detached HEAD"}
+	}
 
-	for _, srcPath := range syncPaths {
-		if _, err := os.Stat(srcPath); os.IsNotExist(err) {
-			continue
+	if pushDryRun {
+		status := "would push"
+		if !repo.HasChanges {
+			status = "no changes"
 		}
+		return opResult{Name: repo.Name, Status: opDryRun, Reason: status}
+	}
 
-		destPath := filepath.Join(destDir, srcPath)
+	if err := git.Push(repo.AbsPath); err != nil {
+		return opResult{Name: repo.Name, Status: opFailed, Err: err}
+	}
+	return opResult{Name: repo.Name, Status: opOK}
+}
 
-		// Ensure destination directory exists
-		if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
-			return err
-		}
+func printPushResult(repo *git.RepoInfo, res opResult) {
+	switch res.Status {
+	case opSkipped:
+		fmt.Printf("  [SKIP] %s (%s)\n", res.Name, res.Reason)
+	case opDryRun:
+		fmt.Printf("  [DRY] %s (%s)\n", res.Name, res.Reason)
+	case opFailed:
+		fmt.Printf("  [PUSH] %s... FAILED (%v)\n", res.Name, res.Err)
+	default:
+		fmt.Printf("  [PUSH] %s... OK\n", res.Name)
+	}
+}
 
-		// Use rsync for syncing (cross-platform alternative could be implemented)
-		cmd := exec.Command("rsync", "-a", "--delete",
-			"--exclude", ".git/",
-			"--exclude", "node_modules/",
-			"--exclude", ".venv/",
-			"--exclude", "venv/",
-			"--exclude", "__pycache__/",
-			"--exclude", ".DS_Store",
-			srcPath, destPath)
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("failed to sync %s: %w", srcPath, err)
-		}
+// syncWorkspaceConfig syncs IDE configs to the workspace-config directory
+func syncWorkspaceConfig(deviceName string, dryRun bool) (*sync.ChangeSet, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	pair := sync.Pair{
+		Local:  workspaceRoot,
+		Remote: metarepoPath("workspace-config", deviceName),
+		Push:   true,
+	}
+	return syncWorkspacePair(cfg, pair, "push/"+deviceName, dryRun)
 }
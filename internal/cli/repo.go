@@ -43,8 +43,12 @@ var repoAddCmd = &cobra.Command{
 var repoScanCmd = &cobra.Command{
 	Use:   "scan",
 	Short: "Scan for repositories and update manifest",
-	Long:  `Scan the workspace for git repositories and update the manifest.`,
-	RunE:  runRepoScan,
+	Long: `Scan the workspace for git repositories and merge them into the manifest.
+
+Existing entries are matched by path and by remote URL. Their URL and branch
+are updated while tags and descriptions are preserved. Entries for repositories
+that are not cloned on this device are kept unless --prune is given.`,
+	RunE: runRepoScan,
 }
 
 var repoRuntimesCmd = &cobra.Command{
@@ -58,6 +62,8 @@ var (
 	repoListShort    bool
 	repoListRuntimes bool
 	repoListAll      bool
+	repoScanPrune    bool
+	repoScanDryRun   bool
 )
 
 func init() {
@@ -71,6 +77,9 @@ func init() {
 	repoListCmd.Flags().BoolVarP(&repoListShort, "short", "s", false, "short output format")
 	repoListCmd.Flags().BoolVarP(&repoListRuntimes, "runtimes", "r", false, "show detected runtimes")
 	repoListCmd.Flags().BoolVarP(&repoListAll, "all", "a", false, "include excluded repos")
+
+	repoScanCmd.Flags().BoolVar(&repoScanPrune, "prune", false, "remove manifest entries for repositories not found locally")
+	repoScanCmd.Flags().BoolVar(&repoScanDryRun, "dry-run", false, "show changes without saving the manifest")
 }
 
 // filterRepos removes excluded repos based on config
@@ -90,13 +99,12 @@ func filterRepos(repos []*git.RepoInfo, cfg *config.Config) []*git.RepoInfo {
 
 // loadConfigSafe loads config or returns nil if not found
 func loadConfigSafe() *config.Config {
-	configPath := filepath.Join(".metarepo", "config.yaml")
-	cfg, _ := config.Load(configPath)
+	cfg, _ := loadConfig()
 	return cfg
 }
 
 func runRepoList(cmd *cobra.Command, args []string) error {
-	repos, err := git.ScanForRepos(".")
+	repos, err := git.ScanForRepos(workspaceRoot)
 	if err != nil {
 		return fmt.Errorf("failed to scan for repositories: %w", err)
 	}
@@ -105,6 +113,7 @@ func runRepoList(cmd *cobra.Command, args []string) error {
 	if !repoListAll {
 		repos = filterRepos(repos, loadConfigSafe())
 	}
+	repos = selectReposByTag(repos)
 
 	if len(repos) == 0 {
 		fmt.Println("No repositories found.")
@@ -168,7 +177,7 @@ func runRepoList(cmd *cobra.Command, args []string) error {
 }
 
 func runRepoRuntimes(cmd *cobra.Command, args []string) error {
-	repos, err := git.ScanForRepos(".")
+	repos, err := git.ScanForRepos(workspaceRoot)
 	if err != nil {
 		return fmt.Errorf("failed to scan for repositories: %w", err)
 	}
@@ -217,13 +226,14 @@ func runRepoRuntimes(cmd *cobra.Command, args []string) error {
 }
 
 func runRepoStatus(cmd *cobra.Command, args []string) error {
-	repos, err := git.ScanForRepos(".")
+	repos, err := git.ScanForRepos(workspaceRoot)
 	if err != nil {
 		return fmt.Errorf("failed to scan for repositories: %w", err)
 	}
 
 	// Filter excluded repos
 	repos = filterRepos(repos, loadConfigSafe())
+	repos = selectReposByTag(repos)
 
 	if len(repos) == 0 {
 		fmt.Println("No repositories found.")
@@ -269,6 +279,12 @@ func runRepoStatus(cmd *cobra.Command, args []string) error {
 }
 
 func runRepoAdd(cmd *cobra.Command, args []string) error {
+	unlock, err := lockWorkspace(cmd)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	url := args[0]
 
 	// Extract repo name from URL
@@ -277,23 +293,23 @@ func runRepoAdd(cmd *cobra.Command, args []string) error {
 
 	// Clone the repository
 	fmt.Printf("Cloning %s...\n", url)
-	if err := git.Clone(url, name); err != nil {
+	if err := git.Clone(url, workspacePath(name)); err != nil {
 		return fmt.Errorf("failed to clone repository: %w", err)
 	}
 
 	// Update manifest
-	manifestPath := filepath.Join(".metarepo", "manifest.yaml")
+	manifestPath := metarepoPath("manifest.yaml")
 	manifest, err := config.LoadManifest(manifestPath)
 	if err != nil {
 		// Create new manifest if it doesn't exist
 		manifest = &config.Manifest{
-			Version:      "1.0",
+			Version:      config.ManifestVersion,
 			Repositories: []config.Repository{},
 		}
 	}
 
 	// Get repo info
-	repoInfo, err := git.GetRepoInfo(name)
+	repoInfo, err := git.GetRepoInfo(workspacePath(name))
 	if err != nil {
 		return fmt.Errorf("failed to get repository info: %w", err)
 	}
@@ -315,38 +331,83 @@ func runRepoAdd(cmd *cobra.Command, args []string) error {
 }
 
 func runRepoScan(cmd *cobra.Command, args []string) error {
+	unlock, err := lockWorkspace(cmd)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	fmt.Println("Scanning for repositories...")
 
-	repos, err := git.ScanForRepos(".")
+	repos, err := git.ScanForRepos(workspaceRoot)
 	if err != nil {
 		return fmt.Errorf("failed to scan for repositories: %w", err)
 	}
 
 	// Load or create manifest
-	manifestPath := filepath.Join(".metarepo", "manifest.yaml")
+	manifestPath := metarepoPath("manifest.yaml")
 	manifest, err := config.LoadManifest(manifestPath)
 	if err != nil {
 		manifest = &config.Manifest{
-			Version:      "1.0",
+			Version:      config.ManifestVersion,
 			Repositories: []config.Repository{},
 		}
 	}
 
-	// Update manifest with found repos
-	manifest.Repositories = make([]config.Repository, 0, len(repos))
+	// Merge found repos into the manifest
+	found := make([]config.Repository, 0, len(repos))
 	for _, repo := range repos {
-		manifest.Repositories = append(manifest.Repositories, config.Repository{
+		branch := repo.Branch
+		if repo.IsDetached {
+			branch = ""
+		}
+		found = append(found, config.Repository{
 			Name:   repo.Name,
 			Path:   repo.Path,
 			URL:    repo.URL,
-			Branch: repo.Branch,
+			Branch: branch,
 		})
 	}
+	diff := manifest.Merge(found, repoScanPrune)
+
+	fmt.Printf("Found %d repositories.\n\n", len(repos))
+	printManifestDiff(diff)
+
+	if diff.IsEmpty() {
+		fmt.Println("Manifest is up to date.")
+		return nil
+	}
+
+	if repoScanDryRun {
+		fmt.Println("Dry run: manifest not saved.")
+		return nil
+	}
 
 	if err := manifest.Save(manifestPath); err != nil {
 		return fmt.Errorf("failed to save manifest: %w", err)
 	}
 
-	fmt.Printf("Found and registered %d repositories.\n", len(repos))
+	fmt.Printf("Manifest updated: %d added, %d changed, %d removed.\n",
+		len(diff.Added), len(diff.Changed), len(diff.Removed))
 	return nil
 }
+
+// printManifestDiff prints the changes a scan made to the manifest
+func printManifestDiff(diff config.ManifestDiff) {
+	for _, repo := range diff.Added {
+		fmt.Printf("  [ADD]  %s (%s)\n", repo.Name, repo.LocalPath())
+	}
+	for _, change := range diff.Changed {
+		fmt.Printf("  [MOD]  %s: %s\n", change.Repo.Name, strings.Join(change.Details, ", "))
+	}
+	for _, repo := range diff.Removed {
+		fmt.Printf("  [DEL]  %s (not found locally)\n", repo.Name)
+	}
+	for _, repo := range diff.Missing {
+		fmt.Printf("  [MISS] %s (not found locally, kept; use --prune to remove)\n", repo.Name)
+	}
+
+	if len(diff.Added)+len(diff.Changed)+len(diff.Removed)+len(diff.Missing) > 0 {
+		fmt.Println()
+	}
+}
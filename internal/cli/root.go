@@ -4,16 +4,24 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 
+	"github.com/JPlanken/metarepo-cli/internal/config"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var (
-	cfgFile string
-	verbose bool
+	cfgFile         string
+	verbose         bool
+	configOverrides []string
 )
 
+// systemConfigPath is the lowest-precedence config file, shared by all users
+var systemConfigPath = filepath.Join("/etc", "metarepo", "config.yaml")
+
+// sourcesReported is set once verbose mode has printed where settings came from
+var sourcesReported bool
+
 // Version info set from main
 var (
 	versionStr = "dev"
@@ -48,45 +56,82 @@ func Execute() error {
 }
 
 func init() {
-	cobra.OnInitialize(initConfig)
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		// init creates a workspace rather than looking for one
+		if cmd == initCmd {
+			return nil
+		}
+		return resolveWorkspace()
+	}
 
 	// Global flags
-	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.config/metarepo/config.yaml)")
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "user config file (default is $HOME/.config/metarepo/config.yaml)")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose output")
+	rootCmd.PersistentFlags().StringVarP(&workspaceFlag, "workspace", "w", "", "workspace root, or name of a registered workspace (default: found from the current directory)")
+	rootCmd.PersistentFlags().StringArrayVar(&configOverrides, "set", nil, "override a setting for this run (key=value, repeatable)")
+}
 
-	// Bind flags to viper
-	viper.BindPFlag("verbose", rootCmd.PersistentFlags().Lookup("verbose"))
+// userConfigDir returns the per-user metarepo directory, ~/.config/metarepo
+func userConfigDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find home directory: %w", err)
+	}
+	return filepath.Join(home, ".config", "metarepo"), nil
 }
 
-// initConfig reads in config file and ENV variables if set.
-func initConfig() {
-	if cfgFile != "" {
-		// Use config file from the flag
-		viper.SetConfigFile(cfgFile)
-	} else {
-		// Find home directory
-		home, err := os.UserHomeDir()
+// configLayers returns the config files merged into the effective
+// configuration, lowest precedence first: system, user, workspace
+func configLayers() ([]config.Layer, error) {
+	userPath := cfgFile
+	if userPath == "" {
+		dir, err := userConfigDir()
 		if err != nil {
-			fmt.Fprintln(os.Stderr, "Error finding home directory:", err)
-			os.Exit(1)
+			return nil, err
 		}
+		userPath = filepath.Join(dir, "config.yaml")
+	}
 
-		// Search for config in these locations (in order of priority)
-		viper.AddConfigPath(".")                                      // Current directory
-		viper.AddConfigPath(filepath.Join(home, ".config", "metarepo")) // User config
-		viper.AddConfigPath("/etc/metarepo")                          // System config
-		viper.SetConfigType("yaml")
-		viper.SetConfigName("config")
+	return []config.Layer{
+		{Name: "system", Path: systemConfigPath},
+		{Name: "user", Path: userPath, Required: cfgFile != ""},
+		{Name: "workspace", Path: workspaceConfigPath(), Required: true},
+	}, nil
+}
+
+// loadConfig returns the effective configuration: the system, user and
+// workspace config files, then METAREPO_* environment variables, then --set
+// flags, each overriding the ones before
+func loadConfig() (*config.Config, error) {
+	cfg, _, err := loadConfigSources()
+	return cfg, err
+}
+
+// loadConfigSources returns the effective configuration and where each
+// setting came from
+func loadConfigSources() (*config.Config, config.Sources, error) {
+	layers, err := configLayers()
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// Read environment variables with METAREPO_ prefix
-	viper.SetEnvPrefix("METAREPO")
-	viper.AutomaticEnv()
+	loader := &config.Loader{Layers: layers, Env: os.Environ(), Overrides: configOverrides}
+	cfg, sources, err := loader.Load()
+	if err != nil {
+		return nil, nil, err
+	}
 
-	// If a config file is found, read it in
-	if err := viper.ReadInConfig(); err == nil {
-		if verbose {
-			fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
+	if verbose && !sourcesReported {
+		sourcesReported = true
+		keys := make([]string, 0, len(sources))
+		for key := range sources {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(os.Stderr, "Config: %s from %s\n", key, sources[key])
 		}
 	}
+
+	return cfg, sources, nil
 }
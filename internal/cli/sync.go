@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/JPlanken/metarepo-cli/internal/config"
+	"github.com/JPlanken/metarepo-cli/internal/sync"
+	"github.com/spf13/cobra"
+)
+
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Workspace configuration sync commands",
+	Long:  `Commands for inspecting how workspace configuration is synced between devices.`,
+}
+
+var syncTargetsCmd = &cobra.Command{
+	Use:   "targets",
+	Short: "List sync targets",
+	Long: `List the configured sync targets and the local files each would sync.
+
+Targets are configured under sync.targets in .metarepo/config.yaml.`,
+	RunE: runSyncTargets,
+}
+
+var syncTargetsFiles bool
+
+func init() {
+	rootCmd.AddCommand(syncCmd)
+	syncCmd.AddCommand(syncTargetsCmd)
+
+	syncTargetsCmd.Flags().BoolVarP(&syncTargetsFiles, "files", "f", false, "list the files each target would sync")
+}
+
+func runSyncTargets(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if len(cfg.Sync.Targets) == 0 {
+		fmt.Println("No sync targets configured.")
+		return nil
+	}
+
+	type targetFiles struct {
+		target config.SyncTarget
+		files  []string
+	}
+	var listed []targetFiles
+
+	root := syncScope{pair: sync.Pair{Local: workspaceRoot}}
+	var repoScopes []syncScope
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tPATHS\tREPOS\tCONFLICT\tFILES\t")
+	for _, target := range cfg.Sync.Targets {
+		scopes := []syncScope{root}
+		repos := "no"
+		if target.Repos {
+			if repoScopes == nil {
+				if repoScopes, err = reposToSync(cfg, root); err != nil {
+					return err
+				}
+			}
+			scopes = append(scopes, repoScopes...)
+			repos = "yes"
+		}
+
+		var files []string
+		for _, scope := range scopes {
+			found, err := sync.ListFiles(scope.pair.Local, target.Paths, targetFilter(cfg, target))
+			if err != nil {
+				return fmt.Errorf("failed to list files for %s: %w", target.Name, err)
+			}
+			for rel := range found {
+				files = append(files, scope.prefix+rel)
+			}
+		}
+		sort.Strings(files)
+		listed = append(listed, targetFiles{target: target, files: files})
+
+		strategy := target.Strategy(cfg.Sync.Conflict)
+		if strategy == "" {
+			strategy = string(sync.StrategyNewest)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t\n", target.Name, strings.Join(target.Paths, ", "), repos, strategy, len(files))
+	}
+	w.Flush()
+
+	if syncTargetsFiles {
+		for _, l := range listed {
+			fmt.Printf("\n%s:\n", l.target.Name)
+			if len(l.files) == 0 {
+				fmt.Println("  (no files)")
+			}
+			for _, f := range l.files {
+				fmt.Printf("  %s\n", f)
+			}
+		}
+	}
+
+	return nil
+}
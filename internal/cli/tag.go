@@ -0,0 +1,246 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/JPlanken/metarepo-cli/internal/config"
+	"github.com/JPlanken/metarepo-cli/internal/git"
+	"github.com/spf13/cobra"
+)
+
+var repoTagCmd = &cobra.Command{
+	Use:   "tag",
+	Short: "Manage repository tags",
+	Long: `Manage tags on repositories in the workspace manifest.
+
+Tags can be used with the global --tag and --not-tag flags to limit
+commands such as pull, push and clone to a subset of repositories.`,
+}
+
+var repoTagAddCmd = &cobra.Command{
+	Use:   "add <repo> <tag>...",
+	Short: "Add tags to a repository",
+	Args:  cobra.MinimumNArgs(2),
+	RunE:  runRepoTagAdd,
+}
+
+var repoTagRemoveCmd = &cobra.Command{
+	Use:   "remove <repo> <tag>...",
+	Short: "Remove tags from a repository",
+	Args:  cobra.MinimumNArgs(2),
+	RunE:  runRepoTagRemove,
+}
+
+var repoTagListCmd = &cobra.Command{
+	Use:   "list [repo]",
+	Short: "List tags",
+	Long:  `List all tags and the repositories that carry them, or the tags of a single repository.`,
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  runRepoTagList,
+}
+
+// Global tag selectors
+var (
+	selectTags  []string
+	excludeTags []string
+)
+
+func init() {
+	repoCmd.AddCommand(repoTagCmd)
+	repoTagCmd.AddCommand(repoTagAddCmd)
+	repoTagCmd.AddCommand(repoTagRemoveCmd)
+	repoTagCmd.AddCommand(repoTagListCmd)
+
+	rootCmd.PersistentFlags().StringSliceVar(&selectTags, "tag", nil, "only operate on repositories with any of these tags")
+	rootCmd.PersistentFlags().StringSliceVar(&excludeTags, "not-tag", nil, "skip repositories with any of these tags")
+}
+
+// loadManifestSafe loads the manifest or returns nil if not found
+func loadManifestSafe() *config.Manifest {
+	manifestPath := metarepoPath("manifest.yaml")
+	manifest, _ := config.LoadManifest(manifestPath)
+	return manifest
+}
+
+// tagSelectionActive reports whether --tag or --not-tag was given
+func tagSelectionActive() bool {
+	return len(selectTags) > 0 || len(excludeTags) > 0
+}
+
+// selectReposByTag filters scanned repos using the global tag selectors.
+// Repos are matched to manifest entries by path, then by name; repos that
+// are not in the manifest have no tags.
+func selectReposByTag(repos []*git.RepoInfo) []*git.RepoInfo {
+	if !tagSelectionActive() {
+		return repos
+	}
+
+	manifest := loadManifestSafe()
+	selected := make([]*git.RepoInfo, 0, len(repos))
+	for _, repo := range repos {
+		entry := &config.Repository{}
+		if manifest != nil {
+			if r := manifest.FindRepository(repo.Path); r != nil {
+				entry = r
+			} else if r := manifest.FindRepository(repo.Name); r != nil {
+				entry = r
+			}
+		}
+		if entry.MatchesTags(selectTags, excludeTags) {
+			selected = append(selected, repo)
+		}
+	}
+	return selected
+}
+
+// selectManifestByTag filters manifest entries using the global tag selectors
+func selectManifestByTag(repos []config.Repository) []config.Repository {
+	if !tagSelectionActive() {
+		return repos
+	}
+
+	selected := make([]config.Repository, 0, len(repos))
+	for _, repo := range repos {
+		if repo.MatchesTags(selectTags, excludeTags) {
+			selected = append(selected, repo)
+		}
+	}
+	return selected
+}
+
+// normalizeTags trims tags and drops empty ones
+func normalizeTags(tags []string) []string {
+	var result []string
+	for _, tag := range tags {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			result = append(result, tag)
+		}
+	}
+	return result
+}
+
+// loadManifestRepo loads the manifest and finds a repository in it
+func loadManifestRepo(nameOrPath string) (*config.Manifest, *config.Repository, error) {
+	manifestPath := metarepoPath("manifest.yaml")
+	manifest, err := config.LoadManifest(manifestPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load manifest: %w", err)
+	}
+
+	// Paths are given relative to the current directory
+	repo := manifest.FindRepository(workspaceRelPath(nameOrPath))
+	if repo == nil {
+		repo = manifest.FindRepository(nameOrPath)
+	}
+	if repo == nil {
+		return nil, nil, fmt.Errorf("repository '%s' not found in manifest (run 'metarepo repo scan' first)", nameOrPath)
+	}
+
+	return manifest, repo, nil
+}
+
+func runRepoTagAdd(cmd *cobra.Command, args []string) error {
+	unlock, err := lockWorkspace(cmd)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	manifest, repo, err := loadManifestRepo(args[0])
+	if err != nil {
+		return err
+	}
+
+	added := repo.AddTags(normalizeTags(args[1:])...)
+	if len(added) == 0 {
+		fmt.Printf("No new tags for '%s'.\n", repo.Name)
+		return nil
+	}
+
+	if err := manifest.Save(metarepoPath("manifest.yaml")); err != nil {
+		return fmt.Errorf("failed to save manifest: %w", err)
+	}
+
+	fmt.Printf("Tagged '%s': %s\n", repo.Name, strings.Join(added, ", "))
+	return nil
+}
+
+func runRepoTagRemove(cmd *cobra.Command, args []string) error {
+	unlock, err := lockWorkspace(cmd)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	manifest, repo, err := loadManifestRepo(args[0])
+	if err != nil {
+		return err
+	}
+
+	removed := repo.RemoveTags(normalizeTags(args[1:])...)
+	if len(removed) == 0 {
+		fmt.Printf("No matching tags on '%s'.\n", repo.Name)
+		return nil
+	}
+
+	if err := manifest.Save(metarepoPath("manifest.yaml")); err != nil {
+		return fmt.Errorf("failed to save manifest: %w", err)
+	}
+
+	fmt.Printf("Removed from '%s': %s\n", repo.Name, strings.Join(removed, ", "))
+	return nil
+}
+
+func runRepoTagList(cmd *cobra.Command, args []string) error {
+	if len(args) == 1 {
+		_, repo, err := loadManifestRepo(args[0])
+		if err != nil {
+			return err
+		}
+		if len(repo.Tags) == 0 {
+			fmt.Printf("'%s' has no tags.\n", repo.Name)
+			return nil
+		}
+		for _, tag := range repo.Tags {
+			fmt.Println(tag)
+		}
+		return nil
+	}
+
+	manifestPath := metarepoPath("manifest.yaml")
+	manifest, err := config.LoadManifest(manifestPath)
+	if err != nil {
+		return fmt.Errorf("failed to load manifest: %w", err)
+	}
+
+	byTag := make(map[string][]string)
+	for _, repo := range manifest.Repositories {
+		for _, tag := range repo.Tags {
+			byTag[tag] = append(byTag[tag], repo.Name)
+		}
+	}
+
+	if len(byTag) == 0 {
+		fmt.Println("No tags defined.")
+		return nil
+	}
+
+	tags := make([]string, 0, len(byTag))
+	for tag := range byTag {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TAG\tCOUNT\tREPOSITORIES\t")
+	for _, tag := range tags {
+		fmt.Fprintf(w, "%s\t%d\t%s\t\n", tag, len(byTag[tag]), strings.Join(byTag[tag], ", "))
+	}
+	w.Flush()
+
+	return nil
+}
@@ -4,9 +4,14 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/JPlanken/metarepo-cli/internal/config"
 	"github.com/JPlanken/metarepo-cli/internal/device"
+	"github.com/JPlanken/metarepo-cli/internal/git"
+	"github.com/JPlanken/metarepo-cli/internal/lock"
 	"github.com/spf13/cobra"
 )
 
@@ -23,17 +28,222 @@ var workspaceInfoCmd = &cobra.Command{
 	RunE:  runWorkspaceInfo,
 }
 
+var workspaceListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the workspaces on this device",
+	Long: `List the workspaces registered in ~/.config/metarepo/workspaces.yaml with their
+last sync and number of repositories with uncommitted changes.
+
+Workspaces are registered by 'metarepo init', 'workspace add' and every push
+or pull. Any command can target a registered workspace by name with -w:
+
+  metarepo -w personal pull`,
+	Args: cobra.NoArgs,
+	RunE: runWorkspaceList,
+}
+
+var workspaceAddCmd = &cobra.Command{
+	Use:   "add [path]",
+	Short: "Register an existing workspace",
+	Long:  `Register the workspace at path (default: the current workspace) in the workspace list.`,
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  runWorkspaceAdd,
+}
+
+var workspaceRemoveCmd = &cobra.Command{
+	Use:   "remove <name>",
+	Short: "Forget a registered workspace",
+	Long:  `Remove a workspace from the workspace list. Its files are not touched.`,
+	Args:  cobra.ExactArgs(1),
+	RunE:  runWorkspaceRemove,
+}
+
+// workspaceRoot is the root of the workspace commands operate on. It is set
+// by resolveWorkspace before a command runs; "." if the current directory is
+// the root.
+var workspaceRoot = "."
+
+// workspaceFlag is the workspace given with --workspace
+var workspaceFlag string
+
 func init() {
 	rootCmd.AddCommand(workspaceCmd)
 	workspaceCmd.AddCommand(workspaceInfoCmd)
+	workspaceCmd.AddCommand(workspaceListCmd)
+	workspaceCmd.AddCommand(workspaceAddCmd)
+	workspaceCmd.AddCommand(workspaceRemoveCmd)
+}
+
+// workspacesPath is the registry of the workspaces on this device
+func workspacesPath() (string, error) {
+	dir, err := userConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "workspaces.yaml"), nil
+}
+
+// registerWorkspace records the workspace at root in the workspace registry,
+// with the current time as its last sync if synced is set. Failures only
+// produce a warning: the registry is a convenience.
+func registerWorkspace(root string, cfg *config.Config, synced bool) {
+	if cfg == nil || cfg.Workspace.ID == "" {
+		return
+	}
+
+	err := func() error {
+		path, err := workspacesPath()
+		if err != nil {
+			return err
+		}
+		registry, err := config.LoadWorkspaceRegistry(path)
+		if err != nil {
+			return err
+		}
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			return err
+		}
+
+		ws := registry.Register(cfg.Workspace.ID, cfg.Workspace.Name, abs)
+		if synced {
+			ws.LastSync = time.Now()
+		}
+		return registry.Save(path)
+	}()
+	if err != nil {
+		fmt.Printf("Warning: Failed to update workspace list: %v\n", err)
+	}
+}
+
+// lockPath is the lock file held by commands that change the workspace
+func lockPath() string {
+	return metarepoPath("local", "lock")
+}
+
+// lockWorkspace keeps other metarepo processes from changing the workspace
+// until the returned function is called. It fails if another process holds
+// the lock.
+func lockWorkspace(cmd *cobra.Command) (func(), error) {
+	if !config.IsWorkspace(workspaceRoot) {
+		return nil, config.ErrNoWorkspace
+	}
+
+	l, err := lock.Acquire(lockPath(), cmd.CommandPath())
+	if err != nil {
+		return nil, err
+	}
+	if l.Stale != nil {
+		fmt.Printf("Warning: Removed stale lock held by %s\n", l.Stale)
+	}
+	return func() {
+		if err := l.Release(); err != nil {
+			fmt.Printf("Warning: Failed to release workspace lock: %v\n", err)
+		}
+	}, nil
+}
+
+// resolveWorkspace sets workspaceRoot from --workspace, METAREPO_WORKSPACE or
+// the closest directory above the current one that has a .metarepo. Outside
+// a workspace, workspaceRoot stays "." and commands report the missing config
+// when they load it.
+func resolveWorkspace() error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	dir, source := workspaceFlag, "--workspace"
+	if dir == "" {
+		dir, source = os.Getenv("METAREPO_WORKSPACE"), "METAREPO_WORKSPACE"
+	}
+
+	var root string
+	if dir != "" {
+		if root, err = lookupWorkspace(dir); err != nil {
+			return fmt.Errorf("%w (set by %s)", err, source)
+		}
+	} else if root, err = config.FindWorkspaceRoot(cwd); err != nil {
+		return nil
+	}
+
+	workspaceRoot = root
+	if root == cwd {
+		workspaceRoot = "."
+	}
+	if verbose && workspaceRoot != "." {
+		fmt.Fprintf(os.Stderr, "Using workspace %s\n", root)
+	}
+	return nil
+}
+
+// lookupWorkspace returns the root of the workspace at dir or, if dir is not
+// a workspace, of the registered workspace named dir
+func lookupWorkspace(dir string) (string, error) {
+	if config.IsWorkspace(dir) {
+		return filepath.Abs(dir)
+	}
+
+	path, err := workspacesPath()
+	if err != nil {
+		return "", err
+	}
+	registry, err := config.LoadWorkspaceRegistry(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to load workspace list: %w", err)
+	}
+	ws, err := registry.Find(dir)
+	if err != nil {
+		return "", err
+	}
+	if !config.IsWorkspace(ws.Path) {
+		return "", fmt.Errorf("workspace %s no longer exists at %s (run 'metarepo workspace remove %s')", ws.Name, ws.Path, ws.Name)
+	}
+	return ws.Path, nil
+}
+
+// metarepoPath returns a path inside the workspace's .metarepo directory
+func metarepoPath(elem ...string) string {
+	return filepath.Join(append([]string{workspaceRoot, config.MetarepoDir}, elem...)...)
+}
+
+// workspacePath resolves a path relative to the workspace root. Absolute
+// paths are returned unchanged.
+func workspacePath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(workspaceRoot, path)
+}
+
+// workspaceRelPath turns a path given on the command line, relative to the
+// current directory, into a path relative to the workspace root. Arguments
+// that are not existing paths, such as repository names, are returned
+// unchanged.
+func workspaceRelPath(arg string) string {
+	if _, err := os.Stat(arg); err != nil {
+		return arg
+	}
+	abs, err := filepath.Abs(arg)
+	if err != nil {
+		return arg
+	}
+	root, err := filepath.Abs(workspaceRoot)
+	if err != nil {
+		return arg
+	}
+	rel, err := filepath.Rel(root, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return arg
+	}
+	return rel
 }
 
 func runWorkspaceInfo(cmd *cobra.Command, args []string) error {
 	// Load workspace config
-	configPath := filepath.Join(".metarepo", "config.yaml")
-	cfg, err := config.Load(configPath)
+	cfg, err := loadConfig()
 	if err != nil {
-		return fmt.Errorf("not in a metarepo workspace (no .metarepo/config.yaml found)")
+		return config.ErrNoWorkspace
 	}
 
 	// Get current device info
@@ -43,28 +253,30 @@ func runWorkspaceInfo(cmd *cobra.Command, args []string) error {
 	}
 
 	// Load device registry
-	devicesPath := filepath.Join(".metarepo", "devices.yaml")
+	devicesPath := metarepoPath("devices")
 	registry, _ := config.LoadDeviceRegistry(devicesPath)
 
 	deviceName := deviceInfo.Hostname
 	if registry != nil {
-		if d := registry.FindDevice(deviceInfo.Serial); d != nil {
+		if d, _ := findCurrentDevice(registry, deviceInfo, false); d != nil {
 			deviceName = d.Name
 		}
 	}
 
-	// Get current working directory
-	cwd, _ := os.Getwd()
+	root, _ := filepath.Abs(workspaceRoot)
 
 	fmt.Println("Workspace Information:")
 	fmt.Println()
 	fmt.Printf("  ID:       %s\n", cfg.Workspace.ID)
 	fmt.Printf("  Name:     %s\n", cfg.Workspace.Name)
+	if owner, err := lock.Read(lockPath()); err == nil && owner != nil {
+		fmt.Printf("  Locked:   by %s\n", owner)
+	}
 	fmt.Println()
 	fmt.Println("Location:")
 	fmt.Printf("  Device:   %s\n", deviceName)
 	fmt.Printf("  Serial:   %s\n", deviceInfo.Serial)
-	fmt.Printf("  Path:     %s\n", cwd)
+	fmt.Printf("  Path:     %s\n", root)
 	fmt.Printf("  Platform: %s/%s\n", deviceInfo.Platform, deviceInfo.Arch)
 	fmt.Println()
 
@@ -74,16 +286,20 @@ func runWorkspaceInfo(cmd *cobra.Command, args []string) error {
 	if cfg.Sync.Remote != "" {
 		fmt.Printf("  Remote:   %s\n", cfg.Sync.Remote)
 	}
-	fmt.Printf("  IDE sync: cursor=%d, claude=%d, vscode=%d paths\n",
-		len(cfg.Sync.IDE.Cursor), len(cfg.Sync.IDE.Claude), len(cfg.Sync.IDE.VSCode))
+	targetNames := make([]string, 0, len(cfg.Sync.Targets))
+	for _, t := range cfg.Sync.Targets {
+		targetNames = append(targetNames, t.Name)
+	}
+	fmt.Printf("  Targets:  %s\n", strings.Join(targetNames, ", "))
 
 	// Show registered devices
 	if registry != nil && len(registry.Devices) > 0 {
 		fmt.Println()
 		fmt.Printf("Registered Devices: %d\n", len(registry.Devices))
-		for _, d := range registry.Devices {
+		currentDevice, _ := findCurrentDevice(registry, deviceInfo, false)
+		for i, d := range registry.Devices {
 			current := ""
-			if d.Serial == deviceInfo.Serial {
+			if &registry.Devices[i] == currentDevice {
 				current = " (current)"
 			}
 			fmt.Printf("  - %s%s\n", d.Name, current)
@@ -92,3 +308,111 @@ func runWorkspaceInfo(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+func runWorkspaceList(cmd *cobra.Command, args []string) error {
+	path, err := workspacesPath()
+	if err != nil {
+		return err
+	}
+	registry, err := config.LoadWorkspaceRegistry(path)
+	if err != nil {
+		return fmt.Errorf("failed to load workspace list: %w", err)
+	}
+
+	if len(registry.Workspaces) == 0 {
+		fmt.Println("No workspaces registered.")
+		fmt.Println("Run 'metarepo workspace add' inside a workspace to register it.")
+		return nil
+	}
+
+	// Mark the workspace the command would operate on
+	current := ""
+	if cfg, err := config.Load(workspaceConfigPath()); err == nil {
+		current = cfg.Workspace.ID
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tID\tPATH\tLAST SYNC\tDIRTY\t")
+
+	for _, ws := range registry.Workspaces {
+		marker := ""
+		if ws.ID == current {
+			marker = " *"
+		}
+
+		lastSync := "never"
+		if !ws.LastSync.IsZero() {
+			lastSync = ws.LastSync.Format("2006-01-02 15:04")
+		}
+
+		dirty := "-"
+		if !config.IsWorkspace(ws.Path) {
+			dirty = "missing"
+		} else if repos, err := git.ScanForRepos(ws.Path); err == nil {
+			count := 0
+			for _, repo := range repos {
+				if repo.HasChanges {
+					count++
+				}
+			}
+			dirty = fmt.Sprint(count)
+		}
+
+		fmt.Fprintf(w, "%s%s\t%s\t%s\t%s\t%s\t\n", ws.Name, marker, ws.ID[:min(8, len(ws.ID))], ws.Path, lastSync, dirty)
+	}
+	w.Flush()
+
+	if current != "" {
+		fmt.Println()
+		fmt.Println("* = current workspace")
+	}
+
+	return nil
+}
+
+func runWorkspaceAdd(cmd *cobra.Command, args []string) error {
+	root := workspaceRoot
+	if len(args) > 0 {
+		var err error
+		if root, err = config.FindWorkspaceRoot(args[0]); err != nil {
+			return fmt.Errorf("%s: %w", args[0], err)
+		}
+	}
+
+	cfg, err := config.Load(filepath.Join(root, config.MetarepoDir, "config.yaml"))
+	if err != nil {
+		return config.ErrNoWorkspace
+	}
+	if cfg.Workspace.ID == "" {
+		return fmt.Errorf("workspace has no ID in its config")
+	}
+
+	registerWorkspace(root, cfg, false)
+	abs, _ := filepath.Abs(root)
+	fmt.Printf("Registered workspace '%s' (%s)\n", cfg.Workspace.Name, abs)
+	return nil
+}
+
+func runWorkspaceRemove(cmd *cobra.Command, args []string) error {
+	path, err := workspacesPath()
+	if err != nil {
+		return err
+	}
+	registry, err := config.LoadWorkspaceRegistry(path)
+	if err != nil {
+		return fmt.Errorf("failed to load workspace list: %w", err)
+	}
+
+	ws, err := registry.Find(args[0])
+	if err != nil {
+		return err
+	}
+	name, id := ws.Name, ws.ID
+	registry.Remove(id)
+	if err := registry.Save(path); err != nil {
+		return fmt.Errorf("failed to save workspace list: %w", err)
+	}
+
+	fmt.Printf("Removed workspace '%s' (%s) from the list.\n", name, id[:min(8, len(id))])
+	return nil
+}
@@ -0,0 +1,574 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/JPlanken/metarepo-cli/internal/config"
+	"github.com/JPlanken/metarepo-cli/internal/fsutil"
+	"github.com/JPlanken/metarepo-cli/internal/git"
+	"github.com/JPlanken/metarepo-cli/internal/jsonmerge"
+	"github.com/JPlanken/metarepo-cli/internal/secrets"
+	"github.com/JPlanken/metarepo-cli/internal/sync"
+)
+
+// syncStatePath is the device-local record of the last synced file hashes
+func syncStatePath() string {
+	return metarepoPath("local", "sync-state.yaml")
+}
+
+// syncBaseDir holds device-local copies of the last synced JSON files, used
+// as the base of three-way merges
+func syncBaseDir() string {
+	return metarepoPath("local", "base")
+}
+
+// basePath returns the last synced copy of rel for a sync state key
+func basePath(stateKey, rel string) string {
+	return filepath.Join(syncBaseDir(), filepath.FromSlash(stateKey), filepath.FromSlash(rel))
+}
+
+// renameSyncState moves the local sync state and merge bases of device
+// oldName to newName, moving the bases back if the state cannot be saved
+func renameSyncState(oldName, newName string) error {
+	state, err := sync.LoadState(syncStatePath())
+	if err != nil {
+		return fmt.Errorf("failed to load sync state: %w", err)
+	}
+
+	var moved [][2]string
+	undo := func() {
+		for _, m := range moved {
+			if err := os.Rename(m[1], m[0]); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to move %s back: %v\n", m[1], err)
+			}
+		}
+	}
+	for _, direction := range []string{"push", "pull"} {
+		oldDir := basePath(direction+"/"+oldName, "")
+		newDir := basePath(direction+"/"+newName, "")
+		// Bases left behind by an earlier device named newName are stale
+		if err := os.RemoveAll(newDir); err != nil {
+			undo()
+			return fmt.Errorf("failed to remove stale merge bases: %w", err)
+		}
+		if err := os.Rename(oldDir, newDir); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			undo()
+			return fmt.Errorf("failed to move merge bases: %w", err)
+		}
+		moved = append(moved, [2]string{oldDir, newDir})
+	}
+
+	state.RenameDevice(oldName, newName)
+	if err := state.Save(syncStatePath()); err != nil {
+		undo()
+		return fmt.Errorf("failed to save sync state: %w", err)
+	}
+	return nil
+}
+
+// targetFilter returns the file filter for a sync target: the built-in
+// excludes, the global sync excludes and the target's own patterns
+func targetFilter(cfg *config.Config, target config.SyncTarget) sync.Filter {
+	excludes := append([]string{}, sync.DefaultExcludes...)
+	excludes = append(excludes, cfg.Sync.Exclude...)
+	excludes = append(excludes, target.Exclude...)
+	return sync.Filter{Include: target.Include, Exclude: excludes}
+}
+
+// syncScope is a pair of directories synced with its own state: the
+// workspace root or a single repository
+type syncScope struct {
+	pair     sync.Pair
+	stateKey string // identifies the pair in the sync state
+	prefix   string // shown before file paths, e.g. "api/"
+}
+
+// syncRun holds what is shared by every scope synced in one operation
+type syncRun struct {
+	cfg          *config.Config
+	state        *sync.State
+	placeholders sync.Placeholders
+	decryptor    *decryptor
+	guard        *secretGuard
+	encryptor    *encryptor
+	dryRun       bool
+}
+
+// syncWorkspacePair syncs every sync target from one side of pair to the
+// other, and targets with repos set inside every repository too. stateKey
+// identifies the pair in the sync state. In dry-run mode nothing is written
+// and the changes that would be made are returned.
+func syncWorkspacePair(cfg *config.Config, pair sync.Pair, stateKey string, dryRun bool) (*sync.ChangeSet, error) {
+	state, err := sync.LoadState(syncStatePath())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sync state: %w", err)
+	}
+
+	placeholders, err := sync.CurrentPlaceholders(pair.Local)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve workspace paths: %w", err)
+	}
+
+	run := &syncRun{
+		cfg:          cfg,
+		state:        state,
+		placeholders: placeholders,
+		decryptor:    newDecryptor(cfg),
+		dryRun:       dryRun,
+	}
+	if pair.Push {
+		if run.guard, err = newSecretGuard(cfg.Sync.Secrets); err != nil {
+			return nil, err
+		}
+		if run.encryptor, err = newEncryptor(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	root := syncScope{pair: pair, stateKey: stateKey}
+	var repoScopes []syncScope
+	for _, target := range cfg.Sync.Targets {
+		if target.Repos && repoScopes == nil {
+			if repoScopes, err = reposToSync(cfg, root); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	total := &sync.ChangeSet{}
+	for _, target := range cfg.Sync.Targets {
+		scopes := []syncScope{root}
+		if target.Repos {
+			scopes = append(scopes, repoScopes...)
+		}
+		for _, scope := range scopes {
+			changes, err := run.syncTarget(target, scope)
+			if err != nil {
+				return nil, fmt.Errorf("target %s: %s%w", target.Name, scope.prefix, err)
+			}
+			addChanges(total, changes, scope.prefix)
+		}
+	}
+	run.guard.report()
+
+	if !dryRun {
+		if err := state.Save(syncStatePath()); err != nil {
+			return nil, fmt.Errorf("failed to save sync state: %w", err)
+		}
+	}
+
+	return total, nil
+}
+
+// addChanges adds changes to total, prefixing their paths
+func addChanges(total, changes *sync.ChangeSet, prefix string) {
+	for _, rel := range changes.Added {
+		total.Added = append(total.Added, prefix+rel)
+	}
+	for _, rel := range changes.Updated {
+		total.Updated = append(total.Updated, prefix+rel)
+	}
+	for _, rel := range changes.Deleted {
+		total.Deleted = append(total.Deleted, prefix+rel)
+	}
+}
+
+// reposToSync returns a scope for every repository in the workspace. A
+// repository's config is stored under repos/<repo-path>/ on the remote side.
+func reposToSync(cfg *config.Config, root syncScope) ([]syncScope, error) {
+	repos, err := git.ScanForRepos(root.pair.Local)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan for repositories: %w", err)
+	}
+
+	scopes := []syncScope{}
+	for _, repo := range repos {
+		if repo.Path == "." || cfg.IsExcluded(repo.Name) {
+			continue
+		}
+		rel := filepath.ToSlash(repo.Path)
+		scopes = append(scopes, syncScope{
+			pair: sync.Pair{
+				Local:  filepath.Join(root.pair.Local, repo.Path),
+				Remote: filepath.Join(root.pair.Remote, "repos", repo.Path),
+				Push:   root.pair.Push,
+			},
+			stateKey: root.stateKey + "/repos/" + rel,
+			prefix:   rel + "/",
+		})
+	}
+	return scopes, nil
+}
+
+// transforms returns the content transform for a scope and the transform
+// for reading its remote side. Content leaving the workspace has its
+// absolute paths replaced with placeholders, is scanned for secrets and
+// encrypted; content coming in is decrypted and expanded.
+func (r *syncRun) transforms(scope syncScope) (transform, incoming sync.TransformFunc) {
+	incoming = chainTransforms(r.decryptor.decrypt, r.placeholders.Expand)
+	if !scope.pair.Push {
+		return incoming, incoming
+	}
+	transform = chainTransforms(
+		r.placeholders.Collapse,
+		r.guard.transform(scope.prefix),
+		r.encryptor.transform(scope.pair.Remote),
+	)
+	return transform, incoming
+}
+
+// syncTarget syncs a single target within scope, resolving files changed on
+// both sides with the target's conflict strategy
+func (r *syncRun) syncTarget(target config.SyncTarget, scope syncScope) (*sync.ChangeSet, error) {
+	strategy, err := sync.ParseStrategy(target.Strategy(r.cfg.Sync.Conflict))
+	if err != nil {
+		return nil, err
+	}
+
+	pair := scope.pair
+	transform, incoming := r.transforms(scope)
+	opts := sync.Options{
+		Filter:    targetFilter(r.cfg, target),
+		Transform: transform,
+		DryRun:    r.dryRun,
+	}
+	cmp, err := sync.Compare(pair, target.Paths, r.state.Base(scope.stateKey), opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare workspace config: %w", err)
+	}
+
+	// Resolve conflicts; kept files are left untouched in the destination.
+	// JSON files changed on both sides are merged on pull instead.
+	kept := make(map[string]bool)
+	merged := make(map[string]bool)
+	var mergedChanges []string
+	var manual []string
+	for _, c := range cmp.Conflicts {
+		name := scope.prefix + c.Path
+		if !pair.Push && c.Kind == sync.BothModified && jsonmerge.Supported(c.Path) {
+			changed, err := mergeJSONConflict(c, scope, strategy, transform, r.dryRun)
+			if err == nil {
+				merged[c.Path] = true
+				if changed {
+					mergedChanges = append(mergedChanges, c.Path)
+				}
+				continue
+			}
+			fmt.Printf("  [MERGE] %s: %v, resolving as a whole file\n", name, err)
+		}
+
+		switch strategy.Resolve(c, pair) {
+		case sync.TakeSource:
+			fmt.Printf("  [CONFLICT] %s (%s): overwritten (%s)\n", name, c.Kind, strategy)
+		case sync.KeepDest:
+			kept[c.Path] = true
+			fmt.Printf("  [CONFLICT] %s (%s): kept (%s)\n", name, c.Kind, strategy)
+		case sync.KeepBoth:
+			kept[c.Path] = true
+			if r.dryRun {
+				manual = append(manual, fmt.Sprintf("%s (%s)", name, c.Kind))
+				continue
+			}
+			copyPath, err := sync.WriteConflictCopy(c, pair, incoming)
+			if err != nil {
+				return nil, fmt.Errorf("failed to write conflict copy for %s: %w", c.Path, err)
+			}
+			if copyPath != "" {
+				manual = append(manual, fmt.Sprintf("%s (%s, other version in %s)", name, c.Kind, copyPath))
+			} else {
+				manual = append(manual, fmt.Sprintf("%s (%s)", name, c.Kind))
+			}
+		}
+	}
+
+	opts.Skip = make(map[string]bool, len(kept)+len(merged))
+	for rel := range kept {
+		opts.Skip[rel] = true
+	}
+	for rel := range merged {
+		opts.Skip[rel] = true
+	}
+	changes, err := sync.Mirror(pair.Source(), pair.Dest(), target.Paths, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sync workspace config: %w", err)
+	}
+	changes.Updated = append(changes.Updated, mergedChanges...)
+
+	if !r.dryRun {
+		r.state.Record(scope.stateKey, target.Paths, cmp.SourceHashes, kept)
+		if !pair.Push {
+			if err := saveMergeBases(scope, cmp.SourceHashes, kept, transform); err != nil {
+				return nil, fmt.Errorf("failed to save merge base: %w", err)
+			}
+		}
+	}
+
+	if len(manual) > 0 {
+		fmt.Printf("  %d conflicts need manual resolution:\n", len(manual))
+		for _, m := range manual {
+			fmt.Printf("    - %s\n", m)
+		}
+	}
+
+	return changes, nil
+}
+
+// mergeJSONConflict merges the remote changes to a JSON file into the local
+// copy, using the copy saved at the last sync as base. Keys changed on both
+// sides are resolved with strategy; with the manual strategy the local value
+// is kept and the remote version is written next to the file. It reports
+// whether the local file changed.
+func mergeJSONConflict(c sync.Conflict, scope syncScope, strategy sync.Strategy, transform sync.TransformFunc, dryRun bool) (bool, error) {
+	pair := scope.pair
+	localPath := filepath.Join(pair.Local, filepath.FromSlash(c.Path))
+	local, err := os.ReadFile(localPath)
+	if err != nil {
+		return false, err
+	}
+	remote, err := sync.ReadFile(pair.Remote, c.Path, transform)
+	if err != nil {
+		return false, err
+	}
+	base, err := os.ReadFile(basePath(scope.stateKey, c.Path))
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+
+	var preferRemote bool
+	switch strategy {
+	case sync.StrategyRemote:
+		preferRemote = true
+	case sync.StrategyNewest:
+		preferRemote = c.SourceTime.After(c.DestTime)
+	}
+
+	result, err := jsonmerge.Merge(base, local, remote, preferRemote)
+	if err != nil {
+		return false, err
+	}
+	changed := string(result.Data) != string(local)
+	if !changed && len(result.Conflicts) == 0 {
+		return false, nil
+	}
+
+	fmt.Printf("  [MERGE] %s%s: %d remote changes, %d conflicts\n", scope.prefix, c.Path, result.Applied, len(result.Conflicts))
+	outcome := "kept local"
+	if preferRemote {
+		outcome = "took remote"
+	}
+	for _, conflict := range result.Conflicts {
+		fmt.Printf("    %s (local %s, remote %s): %s (%s)\n",
+			conflict.Key(), conflictValue(conflict.Local), conflictValue(conflict.Remote), outcome, strategy)
+	}
+
+	if dryRun {
+		return changed, nil
+	}
+
+	if strategy == sync.StrategyManual && len(result.Conflicts) > 0 {
+		copyPath, err := sync.WriteConflictCopy(c, pair, transform)
+		if err != nil {
+			return false, err
+		}
+		fmt.Printf("    remote version in %s\n", copyPath)
+	}
+
+	if changed {
+		info, err := os.Stat(localPath)
+		if err != nil {
+			return false, err
+		}
+		if err := fsutil.WriteFile(localPath, result.Data, info.Mode().Perm()); err != nil {
+			return false, err
+		}
+	}
+	return changed, nil
+}
+
+// conflictValue shortens a JSON value for display
+func conflictValue(value string) string {
+	if value == "" {
+		return "deleted"
+	}
+	if len(value) > 40 {
+		return value[:37] + "..."
+	}
+	return value
+}
+
+// saveMergeBases stores the synced version of every JSON source file as the
+// base of the next merge. Kept files keep their previous base.
+func saveMergeBases(scope syncScope, sourceHashes map[string]string, kept map[string]bool, transform sync.TransformFunc) error {
+	for rel := range sourceHashes {
+		if kept[rel] || !jsonmerge.Supported(rel) {
+			continue
+		}
+		data, err := sync.ReadFile(scope.pair.Source(), rel, transform)
+		if err != nil {
+			return err
+		}
+		path := basePath(scope.stateKey, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := fsutil.WriteFile(path, data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Secret scan actions
+const (
+	secretsBlock  = "block"
+	secretsRedact = "redact"
+	secretsWarn   = "warn"
+	secretsOff    = "off"
+)
+
+// secretGuard scans pushed workspace config for secrets and blocks, redacts
+// or only reports the files they are found in
+type secretGuard struct {
+	action     string
+	scanner    *secrets.Scanner
+	allowPaths []string
+	findings   map[string][]secrets.Finding
+}
+
+// newSecretGuard creates a guard from the secrets config, or returns nil if
+// scanning is turned off
+func newSecretGuard(cfg config.SecretsConfig) (*secretGuard, error) {
+	action := cfg.Action
+	switch action {
+	case "":
+		action = secretsBlock
+	case secretsBlock, secretsRedact, secretsWarn:
+	case secretsOff:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown sync.secrets.action %q (expected block, redact, warn or off)", action)
+	}
+
+	scanner, err := secrets.NewScanner(cfg.Allowlist)
+	if err != nil {
+		return nil, fmt.Errorf("sync.secrets.allowlist: %w", err)
+	}
+
+	return &secretGuard{
+		action:     action,
+		scanner:    scanner,
+		allowPaths: cfg.AllowPaths,
+		findings:   make(map[string][]secrets.Finding),
+	}, nil
+}
+
+// transform returns the sync transform applying the guard to files under
+// prefix, or nil if there is no guard
+func (g *secretGuard) transform(prefix string) sync.TransformFunc {
+	if g == nil {
+		return nil
+	}
+	return func(rel string, data []byte) ([]byte, error) {
+		rel = prefix + rel
+		if sync.MatchAny(rel, false, g.allowPaths) {
+			return data, nil
+		}
+
+		findings := g.scanner.Scan(rel, data)
+		if len(findings) == 0 {
+			return data, nil
+		}
+		// Files are scanned when compared and again when copied
+		g.findings[rel] = findings
+
+		switch g.action {
+		case secretsBlock:
+			return nil, sync.ErrSkipFile
+		case secretsRedact:
+			return secrets.Redact(data, findings), nil
+		default:
+			return data, nil
+		}
+	}
+}
+
+// report prints the findings of the guard, per file and line
+func (g *secretGuard) report() {
+	if g == nil || len(g.findings) == 0 {
+		return
+	}
+
+	outcome := map[string]string{
+		secretsBlock:  "blocked",
+		secretsRedact: "redacted",
+		secretsWarn:   "not blocked",
+	}[g.action]
+
+	paths := make([]string, 0, len(g.findings))
+	count := 0
+	for rel, findings := range g.findings {
+		paths = append(paths, rel)
+		count += len(findings)
+	}
+	sort.Strings(paths)
+
+	fmt.Printf("  Secret scan found %d potential secrets in %d files (%s):\n", count, len(paths), outcome)
+	for _, rel := range paths {
+		for _, f := range g.findings[rel] {
+			fmt.Printf("    %s:%d  %s (%s)\n", rel, f.Line, f.Rule, f.Preview())
+		}
+	}
+	if g.action == secretsBlock {
+		fmt.Println("  Blocked files are not synced. Remove the secrets, add \"" + secrets.AllowMarker + "\" to the line, or set sync.secrets.allowlist.")
+	}
+}
+
+// chainTransforms applies transforms in order, ignoring nil ones. It returns
+// nil if there is nothing to apply.
+func chainTransforms(transforms ...sync.TransformFunc) sync.TransformFunc {
+	var active []sync.TransformFunc
+	for _, t := range transforms {
+		if t != nil {
+			active = append(active, t)
+		}
+	}
+	if len(active) == 0 {
+		return nil
+	}
+
+	return func(rel string, data []byte) ([]byte, error) {
+		var err error
+		for _, t := range active {
+			if data, err = t(rel, data); err != nil {
+				return nil, err
+			}
+		}
+		return data, nil
+	}
+}
+
+// printChangeSet prints the files added, updated and deleted by a sync
+func printChangeSet(changes *sync.ChangeSet, dryRun bool) {
+	prefix := ""
+	if dryRun {
+		prefix = "DRY "
+	}
+	for _, rel := range changes.Added {
+		fmt.Printf("  [%sADD] %s\n", prefix, rel)
+	}
+	for _, rel := range changes.Updated {
+		fmt.Printf("  [%sUPD] %s\n", prefix, rel)
+	}
+	for _, rel := range changes.Deleted {
+		fmt.Printf("  [%sDEL] %s\n", prefix, rel)
+	}
+	if changes.IsEmpty() {
+		fmt.Println("  No changes.")
+	}
+}
@@ -0,0 +1,64 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/JPlanken/metarepo-cli/internal/config"
+	"github.com/JPlanken/metarepo-cli/internal/secrets"
+	"github.com/JPlanken/metarepo-cli/internal/sync"
+)
+
+func TestSecretGuard(t *testing.T) {
+	token := "ghp_" + strings.Repeat("a1B2", 9)
+	data := "export GITHUB_TOKEN=" + token + "\n"
+
+	tests := []struct {
+		name    string
+		cfg     config.SecretsConfig
+		prefix  string
+		rel     string
+		want    string // "" when the file is skipped
+		flagged bool
+	}{
+		{"block by default", config.SecretsConfig{}, "", ".claude/env.sh", "", true},
+		{"redact", config.SecretsConfig{Action: "redact"}, "", ".claude/env.sh", "export GITHUB_TOKEN=" + secrets.Redacted + "\n", true},
+		{"warn", config.SecretsConfig{Action: "warn"}, "", ".claude/env.sh", data, true},
+		{"allowlisted value", config.SecretsConfig{Allowlist: []string{"^ghp_"}}, "", ".claude/env.sh", data, false},
+		{"allowed path", config.SecretsConfig{AllowPaths: []string{".claude/*.sh"}}, "", ".claude/env.sh", data, false},
+		{"allowed path in repo", config.SecretsConfig{AllowPaths: []string{"api/.claude/**"}}, "api/", ".claude/env.sh", data, false},
+		{"other path", config.SecretsConfig{AllowPaths: []string{".cursor/**"}}, "", ".claude/env.sh", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guard, err := newSecretGuard(tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := guard.transform(tt.prefix)(tt.rel, []byte(data))
+			if tt.want == "" {
+				if err != sync.ErrSkipFile {
+					t.Errorf("got %q, %v; want the file skipped", got, err)
+				}
+			} else if err != nil || string(got) != tt.want {
+				t.Errorf("got %q, %v; want %q", got, err, tt.want)
+			}
+			if flagged := len(guard.findings) > 0; flagged != tt.flagged {
+				t.Errorf("flagged = %v, want %v", flagged, tt.flagged)
+			}
+		})
+	}
+}
+
+func TestSecretGuardOff(t *testing.T) {
+	guard, err := newSecretGuard(config.SecretsConfig{Action: "off"})
+	if err != nil || guard != nil {
+		t.Fatalf("newSecretGuard(off) = %v, %v; want nil", guard, err)
+	}
+	if guard.transform("") != nil {
+		t.Error("a nil guard has a transform")
+	}
+	if _, err := newSecretGuard(config.SecretsConfig{Action: "ignore"}); err == nil {
+		t.Error("newSecretGuard accepted an unknown action")
+	}
+}
@@ -1,10 +1,18 @@
 package config
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/JPlanken/metarepo-cli/internal/fsutil"
 	"github.com/google/uuid"
 	"gopkg.in/yaml.v3"
 )
@@ -34,14 +42,29 @@ type WorkspaceConfig struct {
 
 // SyncConfig holds synchronization settings
 type SyncConfig struct {
-	Enabled  bool           `yaml:"enabled"`
-	Remote   string         `yaml:"remote"`
-	Branch   string         `yaml:"branch,omitempty"`
-	IDE      IDEConfig      `yaml:"ide"`
-	Conflict ConflictConfig `yaml:"conflict,omitempty"`
+	Enabled    bool             `yaml:"enabled"`
+	Remote     string           `yaml:"remote"`
+	Branch     string           `yaml:"branch,omitempty"`
+	Targets    []SyncTarget     `yaml:"targets,omitempty"`
+	IDE        IDEConfig        `yaml:"ide,omitempty"`     // Deprecated: migrated into Targets by schema 1.1
+	Exclude    []string         `yaml:"exclude,omitempty"` // Glob patterns never synced (e.g., "*.log", "cache/")
+	Conflict   ConflictConfig   `yaml:"conflict,omitempty"`
+	Secrets    SecretsConfig    `yaml:"secrets,omitempty"`
+	Encryption EncryptionConfig `yaml:"encryption,omitempty"`
 }
 
-// IDEConfig holds IDE-specific sync paths
+// SyncTarget is a named set of workspace paths synced between devices
+type SyncTarget struct {
+	Name     string   `yaml:"name"`
+	Paths    []string `yaml:"paths"`              // Files or directories relative to the workspace root
+	Include  []string `yaml:"include,omitempty"`  // If set, only files matching these patterns are synced
+	Exclude  []string `yaml:"exclude,omitempty"`  // Patterns never synced for this target
+	Conflict string   `yaml:"conflict,omitempty"` // Overrides sync.conflict.strategy
+	Repos    bool     `yaml:"repos,omitempty"`    // Also sync the paths inside every repository
+}
+
+// IDEConfig holds IDE-specific sync paths.
+// Deprecated: use SyncConfig.Targets.
 type IDEConfig struct {
 	Cursor []string `yaml:"cursor,omitempty"`
 	Claude []string `yaml:"claude,omitempty"`
@@ -53,6 +76,19 @@ type ConflictConfig struct {
 	Strategy string `yaml:"strategy,omitempty"` // newest, local, remote, manual
 }
 
+// SecretsConfig holds secret scanning settings for pushed workspace config
+type SecretsConfig struct {
+	Action     string   `yaml:"action,omitempty"`      // block (default), redact, warn, off
+	Allowlist  []string `yaml:"allowlist,omitempty"`   // Regular expressions for values that are not secrets
+	AllowPaths []string `yaml:"allow_paths,omitempty"` // Patterns for files that are never scanned
+}
+
+// EncryptionConfig holds settings for encrypting workspace-config at rest
+type EncryptionConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	Identity string `yaml:"identity,omitempty"` // Private key file (default .metarepo/local/identity.key)
+}
+
 // InventoryConfig holds inventory generation settings
 type InventoryConfig struct {
 	Output  string   `yaml:"output"`
@@ -87,22 +123,29 @@ type Repository struct {
 type DeviceRegistry struct {
 	Version string   `yaml:"version"`
 	Devices []Device `yaml:"devices"`
+
+	files    map[string]string // Device files as last loaded or saved, by name
+	legacy   bool              // Read from the single-file layout
+	salt     string            // Workspace ID the serial hashes are salted with
+	hasSalt  bool              // Whether salt was looked up
+	unhashed int               // Serial numbers read in plain text
 }
 
 // Device represents a single registered device
 type Device struct {
-	Serial     string    `yaml:"serial"`
+	Serial     string    `yaml:"serial"` // Salted hash, see HashSerial
 	Name       string    `yaml:"name"`
 	Platform   string    `yaml:"platform"`
 	Hostname   string    `yaml:"hostname,omitempty"`
 	Registered time.Time `yaml:"registered"`
 	LastSync   time.Time `yaml:"last_sync,omitempty"`
+	PublicKey  string    `yaml:"public_key,omitempty"` // Recipient key for encrypted workspace-config
 }
 
 // DefaultConfig returns a config with sensible defaults
 func DefaultConfig() *Config {
 	return &Config{
-		Version: "1.0",
+		Version: ConfigVersion,
 		Workspace: WorkspaceConfig{
 			ID:   uuid.New().String(),
 			Name: "workspace",
@@ -111,10 +154,10 @@ func DefaultConfig() *Config {
 		Sync: SyncConfig{
 			Enabled: true,
 			Branch:  "main",
-			IDE: IDEConfig{
-				Cursor: []string{".cursor/"},
-				Claude: []string{".claude/"},
-				VSCode: []string{".vscode/"},
+			Targets: []SyncTarget{
+				{Name: "cursor", Paths: []string{".cursor/"}},
+				{Name: "claude", Paths: []string{".claude/"}},
+				{Name: "vscode", Paths: []string{".vscode/"}},
 			},
 			Conflict: ConflictConfig{
 				Strategy: "newest",
@@ -138,13 +181,32 @@ func Load(path string) (*Config, error) {
 	}
 
 	var cfg Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
+	if err := ConfigSchema.decode(data, &cfg); err != nil {
 		return nil, err
 	}
 
 	return &cfg, nil
 }
 
+// FindTarget finds a sync target by name
+func (s *SyncConfig) FindTarget(name string) *SyncTarget {
+	for i := range s.Targets {
+		if s.Targets[i].Name == name {
+			return &s.Targets[i]
+		}
+	}
+	return nil
+}
+
+// Strategy returns the conflict strategy for the target, falling back to
+// the global strategy
+func (t *SyncTarget) Strategy(global ConflictConfig) string {
+	if t.Conflict != "" {
+		return t.Conflict
+	}
+	return global.Strategy
+}
+
 // Save saves configuration to a file
 func (c *Config) Save(path string) error {
 	// Ensure directory exists
@@ -158,7 +220,7 @@ func (c *Config) Save(path string) error {
 		return err
 	}
 
-	return os.WriteFile(path, data, 0644)
+	return fsutil.WriteFile(path, data, 0644)
 }
 
 // LoadManifest loads the repository manifest
@@ -169,7 +231,7 @@ func LoadManifest(path string) (*Manifest, error) {
 	}
 
 	var m Manifest
-	if err := yaml.Unmarshal(data, &m); err != nil {
+	if err := ManifestSchema.decode(data, &m); err != nil {
 		return nil, err
 	}
 
@@ -185,52 +247,467 @@ func (m *Manifest) Save(path string) error {
 		return err
 	}
 
-	return os.WriteFile(path, data, 0644)
+	return fsutil.WriteFile(path, data, 0644)
 }
 
-// LoadDeviceRegistry loads the device registry
-func LoadDeviceRegistry(path string) (*DeviceRegistry, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return &DeviceRegistry{Version: "1.0"}, nil
+// LocalPath returns the repository path relative to the workspace root,
+// defaulting to the repository name
+func (r *Repository) LocalPath() string {
+	if r.Path == "" {
+		return r.Name
+	}
+	return r.Path
+}
+
+// FindRepository finds a repository by path, falling back to name
+func (m *Manifest) FindRepository(nameOrPath string) *Repository {
+	cleaned := filepath.Clean(nameOrPath)
+	for i := range m.Repositories {
+		if filepath.Clean(m.Repositories[i].LocalPath()) == cleaned {
+			return &m.Repositories[i]
+		}
+	}
+	for i := range m.Repositories {
+		if m.Repositories[i].Name == nameOrPath {
+			return &m.Repositories[i]
+		}
+	}
+	return nil
+}
+
+// ManifestChange describes how an existing manifest entry was updated
+type ManifestChange struct {
+	Repo    Repository
+	Details []string // e.g. "branch: main → develop"
+}
+
+// ManifestDiff describes the result of merging scanned repositories into a manifest
+type ManifestDiff struct {
+	Added   []Repository
+	Changed []ManifestChange
+	Removed []Repository // entries pruned because they are absent locally
+	Missing []Repository // entries kept although absent locally
+}
+
+// IsEmpty reports whether the merge changed the manifest
+func (d *ManifestDiff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Changed) == 0 && len(d.Removed) == 0
+}
+
+// Merge merges locally found repositories into the manifest. Existing entries
+// are matched by path, then by remote URL; their URL, branch, name and path
+// are updated while tags and description are preserved. Entries with no local
+// match are kept unless prune is set.
+func (m *Manifest) Merge(found []Repository, prune bool) ManifestDiff {
+	var diff ManifestDiff
+	matched := make([]bool, len(m.Repositories))
+
+	for _, f := range found {
+		idx := -1
+		for i, e := range m.Repositories {
+			if !matched[i] && filepath.Clean(e.LocalPath()) == filepath.Clean(f.LocalPath()) {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 && f.URL != "" {
+			for i, e := range m.Repositories {
+				if !matched[i] && e.URL != "" && normalizeRepoURL(e.URL) == normalizeRepoURL(f.URL) {
+					idx = i
+					break
+				}
+			}
 		}
+
+		if idx < 0 {
+			m.Repositories = append(m.Repositories, f)
+			matched = append(matched, true)
+			diff.Added = append(diff.Added, f)
+			continue
+		}
+
+		matched[idx] = true
+		e := &m.Repositories[idx]
+		var details []string
+		update := func(field string, current *string, value string) {
+			if value != "" && *current != value {
+				details = append(details, field+": "+displayValue(*current)+" → "+value)
+				*current = value
+			}
+		}
+		update("name", &e.Name, f.Name)
+		update("path", &e.Path, f.Path)
+		update("url", &e.URL, f.URL)
+		update("branch", &e.Branch, f.Branch)
+
+		if len(details) > 0 {
+			diff.Changed = append(diff.Changed, ManifestChange{Repo: *e, Details: details})
+		}
+	}
+
+	kept := make([]Repository, 0, len(m.Repositories))
+	for i, e := range m.Repositories {
+		switch {
+		case matched[i]:
+			kept = append(kept, e)
+		case prune:
+			diff.Removed = append(diff.Removed, e)
+		default:
+			diff.Missing = append(diff.Missing, e)
+			kept = append(kept, e)
+		}
+	}
+	m.Repositories = kept
+
+	return diff
+}
+
+// normalizeRepoURL normalizes a remote URL for comparison
+func normalizeRepoURL(url string) string {
+	url = strings.TrimSuffix(strings.TrimSpace(url), "/")
+	url = strings.TrimSuffix(url, ".git")
+	return strings.ToLower(url)
+}
+
+// displayValue returns a printable form of a possibly empty value
+func displayValue(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
+
+// HasTag checks if the repository has the given tag
+func (r *Repository) HasTag(tag string) bool {
+	for _, t := range r.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// AddTags adds tags to the repository, ignoring duplicates.
+// It returns the tags that were actually added.
+func (r *Repository) AddTags(tags ...string) []string {
+	var added []string
+	for _, tag := range tags {
+		if tag == "" || r.HasTag(tag) {
+			continue
+		}
+		r.Tags = append(r.Tags, tag)
+		added = append(added, tag)
+	}
+	sort.Strings(r.Tags)
+	return added
+}
+
+// RemoveTags removes tags from the repository.
+// It returns the tags that were actually removed.
+func (r *Repository) RemoveTags(tags ...string) []string {
+	var removed []string
+	kept := r.Tags[:0]
+	for _, t := range r.Tags {
+		if slices.Contains(tags, t) {
+			removed = append(removed, t)
+		} else {
+			kept = append(kept, t)
+		}
+	}
+	r.Tags = kept
+	if len(r.Tags) == 0 {
+		r.Tags = nil
+	}
+	return removed
+}
+
+// MatchesTags checks a repository against tag selectors. A repository
+// matches if it has any of the include tags (or include is empty) and none
+// of the exclude tags.
+func (r *Repository) MatchesTags(include, exclude []string) bool {
+	for _, tag := range exclude {
+		if r.HasTag(tag) {
+			return false
+		}
+	}
+	if len(include) == 0 {
+		return true
+	}
+	for _, tag := range include {
+		if r.HasTag(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadDeviceRegistry loads the device registry from dir, which holds one
+// file per device. Devices from a registry in the older single-file layout,
+// devices.yaml next to dir, are included; Save moves them into dir.
+func LoadDeviceRegistry(dir string) (*DeviceRegistry, error) {
+	salt, err := registrySalt(dir)
+	if err != nil {
+		return nil, err
+	}
+	reg := &DeviceRegistry{Version: DeviceRegistryVersion, files: map[string]string{}, salt: salt, hasSalt: true}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
 		return nil, err
 	}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".yaml" {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var f deviceFile
+		if err := DeviceSchema.decode(data, &f); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if reg.files[entry.Name()], err = marshalDevice(f.Device); err != nil {
+			return nil, err
+		}
+		if reg.FindDevice(f.Serial) != nil {
+			continue
+		}
+		reg.addLoaded(f.Device)
+	}
 
-	var reg DeviceRegistry
-	if err := yaml.Unmarshal(data, &reg); err != nil {
+	data, err := os.ReadFile(LegacyDeviceRegistryPath(dir))
+	if err != nil && !os.IsNotExist(err) {
 		return nil, err
 	}
+	if err == nil {
+		var legacy DeviceRegistry
+		if err := DeviceRegistrySchema.decode(data, &legacy); err != nil {
+			return nil, err
+		}
+		for _, d := range legacy.Devices {
+			if reg.FindDevice(d.Serial) == nil {
+				reg.addLoaded(d)
+			}
+		}
+		reg.legacy = true
+	}
 
-	return &reg, nil
+	sort.SliceStable(reg.Devices, func(i, j int) bool {
+		a, b := reg.Devices[i], reg.Devices[j]
+		if !a.Registered.Equal(b.Registered) {
+			return a.Registered.Before(b.Registered)
+		}
+		return a.Name < b.Name
+	})
+	return reg, nil
 }
 
-// Save saves the device registry to a file
-func (r *DeviceRegistry) Save(path string) error {
-	data, err := yaml.Marshal(r)
+// LegacyDeviceRegistryPath returns the single-file registry that older
+// versions kept next to the registry directory dir
+func LegacyDeviceRegistryPath(dir string) string {
+	return filepath.Join(filepath.Dir(dir), "devices.yaml")
+}
+
+// registrySalt returns the ID of the workspace whose registry is in dir,
+// or "" if the workspace has no config
+func registrySalt(dir string) (string, error) {
+	cfg, err := Load(filepath.Join(filepath.Dir(dir), "config.yaml"))
 	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to load workspace ID: %w", err)
+	}
+	return cfg.Workspace.ID, nil
+}
+
+// addLoaded adds a device read from disk, hashing a plain serial number
+func (r *DeviceRegistry) addLoaded(d Device) {
+	if !IsSerialHash(d.Serial) {
+		d.Serial = HashSerial(d.Serial, r.salt)
+		r.unhashed++
+	}
+	r.Devices = append(r.Devices, d)
+}
+
+// Migrations describes what Save will change in a registry read from an
+// older format, or nil if it is current
+func (r *DeviceRegistry) Migrations() []string {
+	var changes []string
+	if r.legacy {
+		changes = append(changes, "split devices.yaml into one file per device")
+	}
+	if r.unhashed > 0 {
+		changes = append(changes, fmt.Sprintf("replace %d serial number(s) with salted hashes", r.unhashed))
+	}
+	return changes
+}
+
+// Save saves the device registry to dir. Only the files of devices that
+// changed are written, so devices syncing at the same time don't touch each
+// other's files. Files of removed devices are deleted, as is a registry in
+// the older single-file layout.
+func (r *DeviceRegistry) Save(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
 		return err
 	}
 
-	return os.WriteFile(path, data, 0644)
+	// Devices added to a registry that wasn't loaded, or given a serial
+	// since, still hold the plain serial number
+	if !r.hasSalt {
+		salt, err := registrySalt(dir)
+		if err != nil {
+			return err
+		}
+		r.salt, r.hasSalt = salt, true
+	}
+	for i := range r.Devices {
+		r.Devices[i].Serial = HashSerial(r.Devices[i].Serial, r.salt)
+	}
+
+	files := make(map[string]string, len(r.Devices))
+	for _, d := range r.Devices {
+		name := deviceFileName(d)
+		data, err := marshalDevice(d)
+		if err != nil {
+			return err
+		}
+		files[name] = data
+		if r.files[name] == data {
+			if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+				continue
+			}
+		}
+		if err := fsutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			return err
+		}
+	}
+
+	for name := range r.files {
+		if _, ok := files[name]; ok {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	r.files = files
+
+	if r.legacy {
+		if err := os.Remove(LegacyDeviceRegistryPath(dir)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		r.legacy = false
+	}
+	r.unhashed = 0
+	return nil
+}
+
+// deviceFile is the file of one device in the registry directory
+type deviceFile struct {
+	Version string `yaml:"version"`
+	Device  `yaml:",inline"`
+}
+
+// deviceFileName names a device's file after a hash of its serial number
+func deviceFileName(d Device) string {
+	sum := sha256.Sum256([]byte(d.Serial))
+	return hex.EncodeToString(sum[:8]) + ".yaml"
+}
+
+func marshalDevice(d Device) (string, error) {
+	data, err := yaml.Marshal(&deviceFile{Version: DeviceVersion, Device: d})
+	return string(data), err
+}
+
+// serialHashPrefix marks a serial number stored as a salted hash
+const serialHashPrefix = "sha256:"
+
+// HashSerial returns the form a serial number is stored in the registry: an
+// HMAC keyed with salt, the workspace ID, so the shared registry neither
+// reveals hardware serials nor links a device across workspaces. Serials
+// that are already hashed are returned unchanged.
+func HashSerial(serial, salt string) string {
+	if IsSerialHash(serial) {
+		return serial
+	}
+	mac := hmac.New(sha256.New, []byte(salt))
+	mac.Write([]byte(serial))
+	return serialHashPrefix + hex.EncodeToString(mac.Sum(nil))
 }
 
-// FindDevice finds a device by serial number
+// IsSerialHash reports whether serial is a hash made by HashSerial: the
+// prefix followed by a full hex-encoded SHA-256 digest
+func IsSerialHash(serial string) bool {
+	digest, ok := strings.CutPrefix(serial, serialHashPrefix)
+	if !ok || len(digest) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(digest)
+	return err == nil
+}
+
+// Fingerprint returns a short form of the device's serial hash for display
+func (d *Device) Fingerprint() string {
+	if !IsSerialHash(d.Serial) {
+		return "-"
+	}
+	return strings.TrimPrefix(d.Serial, serialHashPrefix)[:8]
+}
+
+// FindDevice finds a device by its serial number, plain or hashed
 func (r *DeviceRegistry) FindDevice(serial string) *Device {
+	hashed := HashSerial(serial, r.salt)
+	for i := range r.Devices {
+		if r.Devices[i].Serial == hashed || r.Devices[i].Serial == serial {
+			return &r.Devices[i]
+		}
+	}
+	return nil
+}
+
+// FindDeviceByName finds a device by name
+func (r *DeviceRegistry) FindDeviceByName(name string) *Device {
 	for i := range r.Devices {
-		if r.Devices[i].Serial == serial {
+		if r.Devices[i].Name == name {
 			return &r.Devices[i]
 		}
 	}
 	return nil
 }
 
+// ValidateDeviceName checks that name can be used as a directory name under
+// workspace-config and history
+func ValidateDeviceName(name string) error {
+	switch {
+	case strings.TrimSpace(name) == "":
+		return fmt.Errorf("device name must not be empty")
+	case name == "." || name == "..":
+		return fmt.Errorf("invalid device name %q", name)
+	case strings.ContainsAny(name, `/\`):
+		return fmt.Errorf("device name %q must not contain path separators", name)
+	}
+	return nil
+}
+
 // AddDevice adds a new device to the registry
 func (r *DeviceRegistry) AddDevice(d Device) {
 	r.Devices = append(r.Devices, d)
 }
 
+// RemoveDevice removes a device by name
+func (r *DeviceRegistry) RemoveDevice(name string) bool {
+	for i := range r.Devices {
+		if r.Devices[i].Name == name {
+			r.Devices = append(r.Devices[:i], r.Devices[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
 // UpdateLastSync updates the last sync time for a device
 func (r *DeviceRegistry) UpdateLastSync(serial string) {
 	if d := r.FindDevice(serial); d != nil {
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateDeviceName(t *testing.T) {
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"laptop", true},
+		{"work-mac.local", true},
+		{"", false},
+		{"  ", false},
+		{".", false},
+		{"..", false},
+		{"../x", false},
+		{"a/b", false},
+		{`a\b`, false},
+	}
+	for _, tt := range tests {
+		err := ValidateDeviceName(tt.name)
+		if (err == nil) != tt.ok {
+			t.Errorf("ValidateDeviceName(%q) = %v, want ok=%v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	hashed := HashSerial("C02XK0AAJG5H", "workspace-id")
+	tests := []struct {
+		serial string
+		want   string
+	}{
+		{hashed, hashed[len(serialHashPrefix) : len(serialHashPrefix)+8]},
+		{"C02XK0AAJG5H", "-"},
+		{"", "-"},
+		{"sha256:", "-"},
+		{"sha256:abc", "-"},
+		{"sha256:" + strings.Repeat("z", 64), "-"},
+	}
+	for _, tt := range tests {
+		d := Device{Serial: tt.serial}
+		if got := d.Fingerprint(); got != tt.want {
+			t.Errorf("Fingerprint(%q) = %q, want %q", tt.serial, got, tt.want)
+		}
+	}
+}
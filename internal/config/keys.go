@@ -0,0 +1,170 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Get returns the value at a dotted key such as "sync.conflict.strategy".
+// List elements are addressed by index or, for sync targets, by name
+// (e.g. "sync.targets.cursor.paths").
+func (c *Config) Get(key string) (any, error) {
+	v, _, err := lookupKey(reflect.ValueOf(c).Elem(), key)
+	if err != nil {
+		return nil, err
+	}
+	return v.Interface(), nil
+}
+
+// Set parses value into the setting at a dotted key. The value must match
+// the setting's type: "true" for a boolean, a YAML list "[a, b]" or a single
+// element for a list. Strings are used as given.
+func (c *Config) Set(key, value string) error {
+	v, _, err := lookupKey(reflect.ValueOf(c).Elem(), key)
+	if err != nil {
+		return err
+	}
+
+	t := v.Type()
+	single := t.Kind() == reflect.Slice && !strings.HasPrefix(strings.TrimSpace(value), "[")
+	if single {
+		// A single value sets a one-element list
+		t = t.Elem()
+	}
+
+	parsed := reflect.New(t)
+	if t.Kind() == reflect.String {
+		// Strings are taken literally, so patterns like *.log need no quoting
+		parsed.Elem().SetString(value)
+	} else if err := yaml.Unmarshal([]byte(value), parsed.Interface()); err != nil {
+		if _, ok := err.(*yaml.TypeError); ok {
+			return fmt.Errorf("invalid value for %s: expected a %s, got %q", key, typeName(v.Type()), value)
+		}
+		return fmt.Errorf("invalid value for %s: %w", key, err)
+	}
+	if single {
+		v.Set(reflect.Append(reflect.MakeSlice(v.Type(), 0, 1), parsed.Elem()))
+		return nil
+	}
+	v.Set(parsed.Elem())
+	return nil
+}
+
+// CanonicalKey returns key with list elements addressed by name where they
+// have one, e.g. "sync.targets.cursor.paths" for "sync.targets.0.paths"
+func (c *Config) CanonicalKey(key string) (string, error) {
+	_, canonical, err := lookupKey(reflect.ValueOf(c).Elem(), key)
+	return canonical, err
+}
+
+// lookupKey walks a dotted key from v. It also returns the canonical form of
+// the key.
+func lookupKey(v reflect.Value, key string) (reflect.Value, string, error) {
+	if key == "" {
+		return reflect.Value{}, "", fmt.Errorf("empty key")
+	}
+
+	walked, canonical := "", ""
+	for _, part := range strings.Split(key, ".") {
+		parent := walked
+		walked = join(walked, part)
+
+		switch v.Kind() {
+		case reflect.Struct:
+			i, ok := fieldByKey(v.Type(), part)
+			if !ok {
+				return reflect.Value{}, "", fmt.Errorf("unknown key: %s", walked)
+			}
+			v = v.Field(i)
+		case reflect.Slice:
+			i, ok := elementByKey(v, part)
+			if !ok {
+				return reflect.Value{}, "", fmt.Errorf("no element %q in %s", part, parent)
+			}
+			v = v.Index(i)
+			if name := elementName(v); name != "" {
+				part = name
+			}
+		default:
+			return reflect.Value{}, "", fmt.Errorf("unknown key: %s (%s is a %s)", walked, parent, typeName(v.Type()))
+		}
+		canonical = join(canonical, part)
+	}
+	return v, canonical, nil
+}
+
+// fieldByKey returns the index of the struct field with the given YAML name
+func fieldByKey(t reflect.Type, key string) (int, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		if yamlName(t.Field(i)) == key {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// elementByKey returns the index of a list element by position or by its
+// name field
+func elementByKey(v reflect.Value, key string) (int, bool) {
+	if i, err := strconv.Atoi(key); err == nil {
+		return i, i >= 0 && i < v.Len()
+	}
+	if v.Type().Elem().Kind() != reflect.Struct {
+		return 0, false
+	}
+	name, ok := fieldByKey(v.Type().Elem(), "name")
+	if !ok {
+		return 0, false
+	}
+	for i := 0; i < v.Len(); i++ {
+		if v.Index(i).Field(name).String() == key {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// elementName returns the name field of a list element, if it has one
+func elementName(v reflect.Value) string {
+	if v.Kind() != reflect.Struct {
+		return ""
+	}
+	if i, ok := fieldByKey(v.Type(), "name"); ok && v.Field(i).Kind() == reflect.String {
+		return v.Field(i).String()
+	}
+	return ""
+}
+
+// yamlName returns the key a struct field is stored under
+func yamlName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+	if name == "" {
+		return strings.ToLower(f.Name)
+	}
+	return name
+}
+
+// typeName describes a setting's type for error messages
+func typeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int64:
+		return "integer"
+	case reflect.String:
+		return "string"
+	case reflect.Slice:
+		return "list of " + typeName(t.Elem())
+	case reflect.Struct:
+		if t.String() == "time.Time" {
+			return "time"
+		}
+		return "section"
+	default:
+		return t.Kind().String()
+	}
+}
@@ -0,0 +1,200 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix starts the environment variables that override settings, e.g.
+// METAREPO_SYNC_CONFLICT_STRATEGY for sync.conflict.strategy
+const EnvPrefix = "METAREPO_"
+
+// Layer is a config file merged into the effective configuration
+type Layer struct {
+	Name     string // system, user, workspace
+	Path     string
+	Required bool // fail if the file does not exist
+}
+
+// Loader builds the effective configuration from layered config files,
+// environment variables and command-line overrides, each overriding the
+// ones before it
+type Loader struct {
+	Layers    []Layer
+	Env       []string // KEY=value pairs, usually os.Environ()
+	Overrides []string // key=value pairs from the command line
+}
+
+// Sources records where each setting came from, by dotted key. Keys not
+// listed take their value from the closest listed parent key, or the default.
+type Sources map[string]string
+
+// Of returns the source of the value at key
+func (s Sources) Of(key string) string {
+	for k := key; k != ""; {
+		if source, ok := s[k]; ok {
+			return source
+		}
+		i := strings.LastIndex(k, ".")
+		if i < 0 {
+			break
+		}
+		k = k[:i]
+	}
+	return "default"
+}
+
+// set records source for key, replacing the sources of the values under it
+func (s Sources) set(key, source string) {
+	for k := range s {
+		if strings.HasPrefix(k, key+".") {
+			delete(s, k)
+		}
+	}
+	s[key] = source
+}
+
+// Load merges the layers, then applies environment variables and overrides
+func (l *Loader) Load() (*Config, Sources, error) {
+	merged := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	sources := Sources{}
+
+	for _, layer := range l.Layers {
+		data, err := os.ReadFile(layer.Path)
+		if err != nil {
+			if os.IsNotExist(err) && !layer.Required {
+				continue
+			}
+			return nil, nil, err
+		}
+
+		var doc yaml.Node
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", layer.Path, err)
+		}
+		if len(doc.Content) == 0 {
+			continue
+		}
+		if doc.Content[0].Kind != yaml.MappingNode {
+			return nil, nil, fmt.Errorf("%s: expected a mapping", layer.Path)
+		}
+		if _, err := ConfigSchema.Upgrade(&doc); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", layer.Path, err)
+		}
+		mergeNodes(merged, doc.Content[0], "", layer.Name+" ("+layer.Path+")", sources)
+	}
+
+	var cfg Config
+	if err := merged.Decode(&cfg); err != nil {
+		return nil, nil, err
+	}
+
+	env := make(map[string]string, len(l.Env))
+	for _, kv := range l.Env {
+		if k, v, ok := strings.Cut(kv, "="); ok && strings.HasPrefix(k, EnvPrefix) {
+			env[k] = v
+		}
+	}
+	for _, key := range EnvKeys() {
+		name := EnvName(key)
+		value, ok := env[name]
+		if !ok {
+			continue
+		}
+		if err := cfg.Set(key, value); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", name, err)
+		}
+		sources.set(key, "env "+name)
+	}
+
+	for _, override := range l.Overrides {
+		key, value, ok := strings.Cut(override, "=")
+		if !ok {
+			return nil, nil, fmt.Errorf("invalid override %q (expected key=value)", override)
+		}
+		canonical, err := cfg.CanonicalKey(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := cfg.Set(key, value); err != nil {
+			return nil, nil, err
+		}
+		sources.set(canonical, "flag --set")
+	}
+
+	return &cfg, sources, nil
+}
+
+// mergeNodes merges the mapping src into dst. Sections are merged key by
+// key; any other value, including lists, replaces the value in dst.
+func mergeNodes(dst, src *yaml.Node, prefix, source string, sources Sources) {
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+		path := join(prefix, key.Value)
+
+		existing := -1
+		for j := 0; j+1 < len(dst.Content); j += 2 {
+			if dst.Content[j].Value == key.Value {
+				existing = j + 1
+				break
+			}
+		}
+
+		switch {
+		case existing < 0:
+			dst.Content = append(dst.Content, key, value)
+			recordSources(value, path, source, sources)
+		case value.Kind == yaml.MappingNode && dst.Content[existing].Kind == yaml.MappingNode:
+			mergeNodes(dst.Content[existing], value, path, source, sources)
+		default:
+			dst.Content[existing] = value
+			recordSources(value, path, source, sources)
+		}
+	}
+}
+
+// recordSources records source for a value and, for sections, each key in it
+func recordSources(value *yaml.Node, path, source string, sources Sources) {
+	if value.Kind != yaml.MappingNode {
+		sources.set(path, source)
+		return
+	}
+	for i := 0; i+1 < len(value.Content); i += 2 {
+		recordSources(value.Content[i+1], join(path, value.Content[i].Value), source, sources)
+	}
+}
+
+// EnvName returns the environment variable that overrides key
+func EnvName(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// EnvKeys returns the keys that can be set from the environment: every
+// setting outside lists of sections, except deprecated ones
+func EnvKeys() []string {
+	var keys []string
+	var walk func(t reflect.Type, prefix string)
+	walk = func(t reflect.Type, prefix string) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			key := join(prefix, yamlName(f))
+			switch {
+			case f.Type == reflect.TypeOf(IDEConfig{}):
+				// Deprecated, removed by schema migrations
+			case f.Type.Kind() == reflect.Struct:
+				walk(f.Type, key)
+			case f.Type.Kind() == reflect.Slice && f.Type.Elem().Kind() == reflect.Struct:
+			default:
+				keys = append(keys, key)
+			}
+		}
+	}
+	walk(reflect.TypeOf(Config{}), "")
+	sort.Strings(keys)
+	return keys
+}
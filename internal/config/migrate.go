@@ -0,0 +1,276 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/JPlanken/metarepo-cli/internal/fsutil"
+	"gopkg.in/yaml.v3"
+)
+
+// Schema versions written by this version of metarepo
+const (
+	ConfigVersion         = "1.1"
+	ManifestVersion       = "1.0"
+	DeviceRegistryVersion = "1.0" // single-file registry of older versions
+	DeviceVersion         = "1.0" // one file per device in .metarepo/devices/
+)
+
+// ErrNewerVersion is returned for files written by a newer metarepo
+var ErrNewerVersion = errors.New("written by a newer version of metarepo")
+
+// Migration upgrades a file from one schema version to the next
+type Migration struct {
+	From        string
+	To          string
+	Description string
+	Apply       func(doc *yaml.Node) error // doc is the top-level mapping
+}
+
+// Schema describes the versions of one kind of file and how to upgrade them
+type Schema struct {
+	Name       string
+	Version    string // the version this metarepo writes
+	Migrations []Migration
+}
+
+// Schemas of the files in .metarepo
+var (
+	ConfigSchema = &Schema{
+		Name:    "config",
+		Version: ConfigVersion,
+		Migrations: []Migration{
+			{From: "1.0", To: "1.1", Description: "move sync.ide paths into sync.targets", Apply: migrateIDETargets},
+		},
+	}
+	ManifestSchema       = &Schema{Name: "manifest", Version: ManifestVersion}
+	DeviceRegistrySchema = &Schema{Name: "device registry", Version: DeviceRegistryVersion}
+	DeviceSchema         = &Schema{Name: "device", Version: DeviceVersion}
+)
+
+// Upgrade migrates a parsed YAML document to the current version in place
+// and returns the migrations applied. Documents without a version are
+// treated as 1.0. Documents from a newer version are refused.
+func (s *Schema) Upgrade(doc *yaml.Node) ([]Migration, error) {
+	root := doc
+	if root.Kind == yaml.DocumentNode {
+		if len(root.Content) == 0 {
+			return nil, nil
+		}
+		root = root.Content[0]
+	}
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s: expected a mapping", s.Name)
+	}
+
+	version := "1.0"
+	if v := mappingValue(root, "version"); v != nil && v.Value != "" {
+		version = v.Value
+	}
+
+	cmp, err := compareVersions(version, s.Version)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", s.Name, err)
+	}
+	if cmp > 0 {
+		return nil, fmt.Errorf("%s version %s is %w (this version supports %s); upgrade metarepo", s.Name, version, ErrNewerVersion, s.Version)
+	}
+
+	var applied []Migration
+	for version != s.Version {
+		step := s.migrationFrom(version)
+		if step == nil {
+			return nil, fmt.Errorf("%s: no migration from version %s", s.Name, version)
+		}
+		if err := step.Apply(root); err != nil {
+			return nil, fmt.Errorf("%s: migration %s → %s failed: %w", s.Name, step.From, step.To, err)
+		}
+		applied = append(applied, *step)
+		version = step.To
+	}
+
+	if len(applied) > 0 || mappingValue(root, "version") == nil {
+		setMappingValue(root, "version", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: s.Version, Style: yaml.DoubleQuotedStyle}, true)
+	}
+	return applied, nil
+}
+
+// MigrateFile upgrades the file at path and returns the version it had and
+// the migrations applied. Unless dryRun is set, the file is rewritten if any
+// migrations were applied; comments are kept.
+func (s *Schema) MigrateFile(path string, dryRun bool) (string, []Migration, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return "", nil, err
+	}
+	if len(doc.Content) == 0 {
+		return "", nil, nil
+	}
+
+	from := "1.0"
+	if v := mappingValue(doc.Content[0], "version"); v != nil && v.Value != "" {
+		from = v.Value
+	}
+
+	applied, err := s.Upgrade(&doc)
+	if err != nil || len(applied) == 0 || dryRun {
+		return from, applied, err
+	}
+
+	out, err := yaml.Marshal(&doc)
+	if err != nil {
+		return "", nil, err
+	}
+	return from, applied, fsutil.WriteFile(path, out, 0644)
+}
+
+// decode upgrades data and decodes it into v
+func (s *Schema) decode(data []byte, v any) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	if _, err := s.Upgrade(&doc); err != nil {
+		return err
+	}
+	return doc.Decode(v)
+}
+
+func (s *Schema) migrationFrom(version string) *Migration {
+	for i := range s.Migrations {
+		if s.Migrations[i].From == version {
+			return &s.Migrations[i]
+		}
+	}
+	return nil
+}
+
+// compareVersions compares "major.minor" versions
+func compareVersions(a, b string) (int, error) {
+	pa, err := parseVersion(a)
+	if err != nil {
+		return 0, err
+	}
+	pb, err := parseVersion(b)
+	if err != nil {
+		return 0, err
+	}
+	for i := range pa {
+		if pa[i] != pb[i] {
+			if pa[i] < pb[i] {
+				return -1, nil
+			}
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func parseVersion(v string) ([2]int, error) {
+	var parts [2]int
+	major, minor, _ := strings.Cut(v, ".")
+	var err error
+	if parts[0], err = strconv.Atoi(major); err != nil {
+		return parts, fmt.Errorf("invalid version %q", v)
+	}
+	if minor != "" {
+		if parts[1], err = strconv.Atoi(minor); err != nil {
+			return parts, fmt.Errorf("invalid version %q", v)
+		}
+	}
+	return parts, nil
+}
+
+// migrateIDETargets converts the per-IDE path lists of sync.ide into sync
+// targets. Targets that already exist by name are left untouched.
+func migrateIDETargets(doc *yaml.Node) error {
+	sync := mappingValue(doc, "sync")
+	if sync == nil || sync.Kind != yaml.MappingNode {
+		return nil
+	}
+	ide := mappingValue(sync, "ide")
+	if ide == nil {
+		return nil
+	}
+	defer deleteMappingKey(sync, "ide")
+	if ide.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	targets := mappingValue(sync, "targets")
+	existing := map[string]bool{}
+	if targets != nil {
+		for _, t := range targets.Content {
+			if name := mappingValue(t, "name"); name != nil {
+				existing[name.Value] = true
+			}
+		}
+	}
+
+	for _, name := range []string{"cursor", "claude", "vscode"} {
+		paths := mappingValue(ide, name)
+		if paths == nil || paths.Kind != yaml.SequenceNode || len(paths.Content) == 0 || existing[name] {
+			continue
+		}
+		if targets == nil || targets.Kind != yaml.SequenceNode {
+			targets = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+			setMappingValue(sync, "targets", targets, false)
+		}
+		target := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		setMappingValue(target, "name", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: name}, false)
+		setMappingValue(target, "paths", paths, false)
+		targets.Content = append(targets.Content, target)
+	}
+	return nil
+}
+
+// mappingValue returns the value of key in a mapping node, or nil
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setMappingValue sets key in a mapping node, adding it at the start or end
+// if it is missing
+func setMappingValue(node *yaml.Node, key string, value *yaml.Node, first bool) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			node.Content[i+1] = value
+			return
+		}
+	}
+	pair := []*yaml.Node{{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value}
+	if first {
+		node.Content = append(pair, node.Content...)
+	} else {
+		node.Content = append(node.Content, pair...)
+	}
+}
+
+// deleteMappingKey removes key from a mapping node
+func deleteMappingKey(node *yaml.Node, key string) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			node.Content = append(node.Content[:i], node.Content[i+2:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConflictStrategies are the valid values of conflict.strategy
+var ConflictStrategies = []string{"newest", "local", "remote", "manual"}
+
+// SecretActions are the valid values of secrets.action
+var SecretActions = []string{"block", "redact", "warn", "off"}
+
+// Issue is a problem found in a config file
+type Issue struct {
+	Line    int
+	Key     string
+	Message string
+}
+
+func (i Issue) String() string {
+	if i.Line == 0 {
+		return fmt.Sprintf("%s: %s", i.Key, i.Message)
+	}
+	return fmt.Sprintf("line %d: %s: %s", i.Line, i.Key, i.Message)
+}
+
+// valueChecks validate scalar values by key path, with list elements written
+// as "[]"
+var valueChecks = map[string]func(value string) string{
+	"sync.conflict.strategy":     checkOneOf(ConflictStrategies),
+	"sync.targets[].conflict":    checkOneOf(ConflictStrategies),
+	"sync.secrets.action":        checkOneOf(SecretActions),
+	"sync.exclude[]":             checkGlob,
+	"sync.targets[].include[]":   checkGlob,
+	"sync.targets[].exclude[]":   checkGlob,
+	"sync.secrets.allow_paths[]": checkGlob,
+	"sync.secrets.allowlist[]":   checkRegexp,
+	"repos.exclude[]":            checkGlob,
+	"sync.targets[].name":        checkRequired,
+	"sync.targets[].paths[]":     checkRequired,
+}
+
+// Validate checks a config file for unknown keys, values of the wrong type
+// and invalid settings. Issues carry the line they were found on.
+func Validate(data []byte) ([]Issue, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+
+	var issues []Issue
+	if v := mappingValue(doc.Content[0], "version"); v != nil {
+		if cmp, err := compareVersions(v.Value, ConfigVersion); err != nil {
+			issues = append(issues, Issue{Line: v.Line, Key: "version", Message: err.Error()})
+		} else if cmp > 0 {
+			issues = append(issues, Issue{Line: v.Line, Key: "version", Message: fmt.Sprintf("version %s is newer than the supported %s; upgrade metarepo", v.Value, ConfigVersion)})
+		}
+	}
+	validateNode(doc.Content[0], reflect.TypeOf(Config{}), "", "", &issues)
+	return issues, nil
+}
+
+// validateNode checks node against type t. key is the dotted key for
+// messages; pattern is the key with list indexes replaced by "[]".
+func validateNode(node *yaml.Node, t reflect.Type, key, pattern string, issues *[]Issue) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	fail := func(line int, msg string) {
+		*issues = append(*issues, Issue{Line: line, Key: displayKey(key), Message: msg})
+	}
+	if node.Tag == "!!null" {
+		return
+	}
+
+	switch {
+	case t.Kind() == reflect.Struct && t.String() != "time.Time":
+		if node.Kind != yaml.MappingNode {
+			fail(node.Line, "expected a section")
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			k, v := node.Content[i], node.Content[i+1]
+			field, ok := fieldByKey(t, k.Value)
+			if !ok {
+				*issues = append(*issues, Issue{Line: k.Line, Key: displayKey(join(key, k.Value)), Message: "unknown key"})
+				continue
+			}
+			validateNode(v, t.Field(field).Type, join(key, k.Value), join(pattern, k.Value), issues)
+		}
+
+	case t.Kind() == reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			fail(node.Line, "expected a list")
+			return
+		}
+		for i, item := range node.Content {
+			validateNode(item, t.Elem(), fmt.Sprintf("%s[%d]", key, i), pattern+"[]", issues)
+		}
+
+	default:
+		if node.Kind != yaml.ScalarNode {
+			fail(node.Line, "expected a "+typeName(t))
+			return
+		}
+		if err := node.Decode(reflect.New(t).Interface()); err != nil {
+			fail(node.Line, fmt.Sprintf("expected a %s, got %q", typeName(t), node.Value))
+			return
+		}
+		if check := valueChecks[pattern]; check != nil {
+			if msg := check(node.Value); msg != "" {
+				fail(node.Line, msg)
+			}
+		}
+	}
+}
+
+func checkOneOf(values []string) func(string) string {
+	return func(value string) string {
+		if value == "" || slices.Contains(values, value) {
+			return ""
+		}
+		return fmt.Sprintf("invalid value %q (expected %s)", value, strings.Join(values, ", "))
+	}
+}
+
+func checkGlob(value string) string {
+	if _, err := path.Match(strings.TrimSuffix(strings.TrimPrefix(value, "/"), "/"), ""); err != nil {
+		return fmt.Sprintf("invalid pattern %q", value)
+	}
+	return ""
+}
+
+func checkRegexp(value string) string {
+	if _, err := regexp.Compile(value); err != nil {
+		return fmt.Sprintf("invalid regular expression %q: %v", value, err)
+	}
+	return ""
+}
+
+func checkRequired(value string) string {
+	if strings.TrimSpace(value) == "" {
+		return "must not be empty"
+	}
+	return ""
+}
+
+func join(key, name string) string {
+	if key == "" {
+		return name
+	}
+	return key + "." + name
+}
+
+func displayKey(key string) string {
+	if key == "" {
+		return "(root)"
+	}
+	return key
+}
@@ -0,0 +1,164 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/JPlanken/metarepo-cli/internal/fsutil"
+	"gopkg.in/yaml.v3"
+)
+
+// MetarepoDir is the directory holding a workspace's metadata
+const MetarepoDir = ".metarepo"
+
+// ErrNoWorkspace is returned when no workspace contains a directory
+var ErrNoWorkspace = errors.New("not in a metarepo workspace (no .metarepo/config.yaml found)")
+
+// IsWorkspace reports whether dir is a workspace root
+func IsWorkspace(dir string) bool {
+	info, err := os.Stat(filepath.Join(dir, MetarepoDir, "config.yaml"))
+	return err == nil && !info.IsDir()
+}
+
+// FindWorkspaceRoot returns the closest directory at or above dir that is a
+// workspace root
+func FindWorkspaceRoot(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		if IsWorkspace(dir) {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", ErrNoWorkspace
+		}
+		dir = parent
+	}
+}
+
+// WorkspaceRegistry lists the workspaces on this device, across all of them
+type WorkspaceRegistry struct {
+	Version    string                `yaml:"version"`
+	Workspaces []RegisteredWorkspace `yaml:"workspaces"`
+}
+
+// RegisteredWorkspace is a workspace known on this device
+type RegisteredWorkspace struct {
+	ID       string    `yaml:"id"`
+	Name     string    `yaml:"name"`
+	Path     string    `yaml:"path"` // Absolute path of the workspace root
+	LastSync time.Time `yaml:"last_sync,omitempty"`
+}
+
+// LoadWorkspaceRegistry loads the workspace registry
+func LoadWorkspaceRegistry(path string) (*WorkspaceRegistry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &WorkspaceRegistry{Version: "1.0"}, nil
+		}
+		return nil, err
+	}
+
+	var reg WorkspaceRegistry
+	if err := yaml.Unmarshal(data, &reg); err != nil {
+		return nil, err
+	}
+
+	return &reg, nil
+}
+
+// Save saves the workspace registry to a file
+func (r *WorkspaceRegistry) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	data, err := yaml.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	return fsutil.WriteFile(path, data, 0644)
+}
+
+// Register adds a workspace or updates the name and path of a workspace with
+// the same ID, returning the entry
+func (r *WorkspaceRegistry) Register(id, name, path string) *RegisteredWorkspace {
+	if ws := r.FindByID(id); ws != nil {
+		ws.Name = name
+		ws.Path = path
+		return ws
+	}
+
+	// A workspace re-initialized in place gets a new ID
+	for i := range r.Workspaces {
+		if r.Workspaces[i].Path == path {
+			r.Workspaces[i] = RegisteredWorkspace{ID: id, Name: name, Path: path}
+			return &r.Workspaces[i]
+		}
+	}
+
+	r.Workspaces = append(r.Workspaces, RegisteredWorkspace{ID: id, Name: name, Path: path})
+	return &r.Workspaces[len(r.Workspaces)-1]
+}
+
+// Remove removes the workspace with the given ID
+func (r *WorkspaceRegistry) Remove(id string) bool {
+	for i := range r.Workspaces {
+		if r.Workspaces[i].ID == id {
+			r.Workspaces = append(r.Workspaces[:i], r.Workspaces[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// FindByID finds a workspace by ID
+func (r *WorkspaceRegistry) FindByID(id string) *RegisteredWorkspace {
+	for i := range r.Workspaces {
+		if r.Workspaces[i].ID == id {
+			return &r.Workspaces[i]
+		}
+	}
+	return nil
+}
+
+// Find finds a workspace by name or by a prefix of its ID. It fails if
+// several workspaces match.
+func (r *WorkspaceRegistry) Find(nameOrID string) (*RegisteredWorkspace, error) {
+	var matches []*RegisteredWorkspace
+	for i := range r.Workspaces {
+		if r.Workspaces[i].Name == nameOrID {
+			matches = append(matches, &r.Workspaces[i])
+		}
+	}
+	if len(matches) == 0 && nameOrID != "" {
+		for i := range r.Workspaces {
+			if strings.HasPrefix(r.Workspaces[i].ID, nameOrID) {
+				matches = append(matches, &r.Workspaces[i])
+			}
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("workspace not found: %s", nameOrID)
+	case 1:
+		return matches[0], nil
+	default:
+		ids := make([]string, len(matches))
+		for i, ws := range matches {
+			ids[i] = ws.ID[:min(8, len(ws.ID))]
+		}
+		return nil, fmt.Errorf("workspace %q is ambiguous (use an ID: %s)", nameOrID, strings.Join(ids, ", "))
+	}
+}
@@ -0,0 +1,324 @@
+// Package crypt encrypts files to a set of X25519 recipients.
+//
+// Every file gets a random key that encrypts its body with AES-256-GCM. The
+// file key is wrapped once per recipient with a key derived (HKDF-SHA256)
+// from an X25519 exchange between an ephemeral key and the recipient's public
+// key, so any one recipient's identity can decrypt the file.
+package crypt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/JPlanken/metarepo-cli/internal/fsutil"
+)
+
+const (
+	header        = "metarepo-encrypted/v1\n"
+	stanzaPrefix  = "-> x25519 "
+	headerEnd     = "---\n"
+	publicPrefix  = "mrpk1"
+	privatePrefix = "MRSK1"
+	wrapInfo      = "metarepo x25519 file key"
+	fileKeySize   = 32
+)
+
+var b64 = base64.RawURLEncoding
+
+// ErrNotRecipient is returned when a file isn't encrypted to an identity
+var ErrNotRecipient = errors.New("file is not encrypted to this device's key")
+
+// Identity is a device's private key
+type Identity struct {
+	key *ecdh.PrivateKey
+}
+
+// Recipient is a device's public key
+type Recipient struct {
+	key *ecdh.PublicKey
+}
+
+// GenerateIdentity creates a new random identity
+func GenerateIdentity() (*Identity, error) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{key: key}, nil
+}
+
+// ParseIdentity parses an identity in the form written by String
+func ParseIdentity(s string) (*Identity, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, privatePrefix) {
+		return nil, fmt.Errorf("invalid identity: missing %s prefix", privatePrefix)
+	}
+	raw, err := b64.DecodeString(strings.TrimPrefix(s, privatePrefix))
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity: %w", err)
+	}
+	key, err := ecdh.X25519().NewPrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity: %w", err)
+	}
+	return &Identity{key: key}, nil
+}
+
+// LoadIdentity reads an identity file
+func LoadIdentity(path string) (*Identity, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseIdentity(string(data))
+}
+
+// Save writes the identity to a file readable only by the current user
+func (id *Identity) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return fsutil.WriteFile(path, []byte(id.String()+"\n"), 0600)
+}
+
+// String encodes the identity. It is secret.
+func (id *Identity) String() string {
+	return privatePrefix + b64.EncodeToString(id.key.Bytes())
+}
+
+// Recipient returns the public key of the identity
+func (id *Identity) Recipient() *Recipient {
+	return &Recipient{key: id.key.PublicKey()}
+}
+
+// ParseRecipient parses a public key in the form written by String
+func ParseRecipient(s string) (*Recipient, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, publicPrefix) {
+		return nil, fmt.Errorf("invalid public key: missing %s prefix", publicPrefix)
+	}
+	raw, err := b64.DecodeString(strings.TrimPrefix(s, publicPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	key, err := ecdh.X25519().NewPublicKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	return &Recipient{key: key}, nil
+}
+
+// String encodes the public key
+func (r *Recipient) String() string {
+	return publicPrefix + b64.EncodeToString(r.key.Bytes())
+}
+
+// Tag returns a short fingerprint of the public key, stored in encrypted
+// files to tell which recipients they were encrypted to
+func (r *Recipient) Tag() string {
+	sum := sha256.Sum256(r.key.Bytes())
+	return b64.EncodeToString(sum[:6])
+}
+
+// IsEncrypted reports whether data was written by Encrypt
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(header))
+}
+
+// Encrypt encrypts plaintext to every recipient
+func Encrypt(plaintext []byte, recipients []*Recipient) ([]byte, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("no recipients")
+	}
+
+	fileKey := make([]byte, fileKeySize)
+	if _, err := rand.Read(fileKey); err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	out.WriteString(header)
+	for _, r := range recipients {
+		ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		wrapped, err := wrapKey(ephemeral, r.key, fileKey)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&out, "%s%s %s %s\n", stanzaPrefix, r.Tag(),
+			b64.EncodeToString(ephemeral.PublicKey().Bytes()), b64.EncodeToString(wrapped))
+	}
+	out.WriteString(headerEnd)
+
+	aead, err := newAEAD(fileKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	// The header is authenticated so the recipient list can't be altered
+	body := aead.Seal(nil, nonce, plaintext, out.Bytes())
+	out.Write(nonce)
+	out.Write(body)
+	return out.Bytes(), nil
+}
+
+// Decrypt decrypts data with the identity
+func Decrypt(data []byte, id *Identity) ([]byte, error) {
+	stanzas, body, err := parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	tag := id.Recipient().Tag()
+	for _, s := range stanzas {
+		if s.tag != tag {
+			continue
+		}
+		fileKey, err := unwrapKey(id.key, s.ephemeral, s.wrapped)
+		if err != nil {
+			continue
+		}
+
+		aead, err := newAEAD(fileKey)
+		if err != nil {
+			return nil, err
+		}
+		if len(body) < aead.NonceSize() {
+			return nil, errors.New("truncated encrypted file")
+		}
+		headerLen := len(data) - len(body)
+		plaintext, err := aead.Open(nil, body[:aead.NonceSize()], body[aead.NonceSize():], data[:headerLen])
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt: %w", err)
+		}
+		return plaintext, nil
+	}
+
+	return nil, ErrNotRecipient
+}
+
+// RecipientTags returns the sorted tags of the recipients data is encrypted to
+func RecipientTags(data []byte) ([]string, error) {
+	stanzas, _, err := parse(data)
+	if err != nil {
+		return nil, err
+	}
+	tags := make([]string, 0, len(stanzas))
+	for _, s := range stanzas {
+		tags = append(tags, s.tag)
+	}
+	sort.Strings(tags)
+	return tags, nil
+}
+
+// stanza is a file key wrapped for one recipient
+type stanza struct {
+	tag       string
+	ephemeral []byte
+	wrapped   []byte
+}
+
+// parse splits an encrypted file into its recipient stanzas and body
+func parse(data []byte) ([]stanza, []byte, error) {
+	if !IsEncrypted(data) {
+		return nil, nil, errors.New("not an encrypted file")
+	}
+
+	reader := bufio.NewReader(bytes.NewReader(data[len(header):]))
+	consumed := len(header)
+	var stanzas []stanza
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, nil, errors.New("malformed encrypted file header")
+		}
+		consumed += len(line)
+		if line == headerEnd {
+			break
+		}
+
+		fields := strings.Fields(strings.TrimPrefix(line, stanzaPrefix))
+		if !strings.HasPrefix(line, stanzaPrefix) || len(fields) != 3 {
+			return nil, nil, errors.New("malformed recipient stanza")
+		}
+		ephemeral, err := b64.DecodeString(fields[1])
+		if err != nil {
+			return nil, nil, fmt.Errorf("malformed recipient stanza: %w", err)
+		}
+		wrapped, err := b64.DecodeString(fields[2])
+		if err != nil {
+			return nil, nil, fmt.Errorf("malformed recipient stanza: %w", err)
+		}
+		stanzas = append(stanzas, stanza{tag: fields[0], ephemeral: ephemeral, wrapped: wrapped})
+	}
+
+	return stanzas, data[consumed:], nil
+}
+
+// wrapKey encrypts the file key for a recipient
+func wrapKey(ephemeral *ecdh.PrivateKey, recipient *ecdh.PublicKey, fileKey []byte) ([]byte, error) {
+	aead, err := deriveWrapAEAD(ephemeral, recipient, ephemeral.PublicKey().Bytes(), recipient.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	// Each wrapping key is used exactly once, so a zero nonce is safe
+	return aead.Seal(nil, make([]byte, aead.NonceSize()), fileKey, nil), nil
+}
+
+// unwrapKey decrypts a file key wrapped for the identity
+func unwrapKey(identity *ecdh.PrivateKey, ephemeral, wrapped []byte) ([]byte, error) {
+	ephemeralKey, err := ecdh.X25519().NewPublicKey(ephemeral)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := deriveWrapAEAD(identity, ephemeralKey, ephemeral, identity.PublicKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return aead.Open(nil, make([]byte, aead.NonceSize()), wrapped, nil)
+}
+
+// deriveWrapAEAD derives the key wrapping cipher from an X25519 exchange.
+// The salt binds it to the ephemeral and recipient public keys.
+func deriveWrapAEAD(private *ecdh.PrivateKey, peer *ecdh.PublicKey, ephemeral, recipient []byte) (cipher.AEAD, error) {
+	shared, err := private.ECDH(peer)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := append(append([]byte{}, ephemeral...), recipient...)
+
+	key, err := hkdf.Key(sha256.New, shared, salt, wrapInfo, fileKeySize)
+	if err != nil {
+		return nil, err
+	}
+	return newAEAD(key)
+}
+
+// newAEAD returns AES-256-GCM with key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,160 @@
+package crypt
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func mustIdentity(t *testing.T) *Identity {
+	t.Helper()
+	id, err := GenerateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	alice, bob, eve := mustIdentity(t), mustIdentity(t), mustIdentity(t)
+	both := []*Recipient{alice.Recipient(), bob.Recipient()}
+
+	tests := []struct {
+		name       string
+		plaintext  string
+		recipients []*Recipient
+		identity   *Identity
+		tamper     func([]byte) []byte
+		wantErr    error // nil for success; errAny for any error
+	}{
+		{name: "single recipient", plaintext: `{"a": 1}`, recipients: []*Recipient{alice.Recipient()}, identity: alice},
+		{name: "first of two", plaintext: "hello", recipients: both, identity: alice},
+		{name: "second of two", plaintext: "hello", recipients: both, identity: bob},
+		{name: "empty plaintext", plaintext: "", recipients: both, identity: bob},
+		{name: "wrong recipient", plaintext: "hello", recipients: both, identity: eve, wantErr: ErrNotRecipient},
+		{
+			name: "tampered body", plaintext: "hello", recipients: both, identity: alice, wantErr: errAny,
+			tamper: func(data []byte) []byte {
+				data[len(data)-1] ^= 1
+				return data
+			},
+		},
+		{
+			name: "tampered header", plaintext: "hello", recipients: both, identity: alice, wantErr: errAny,
+			tamper: func(data []byte) []byte {
+				// Dropping the other recipient changes the authenticated header
+				i := bytes.LastIndex(data, []byte(stanzaPrefix))
+				j := bytes.IndexByte(data[i:], '\n')
+				return append(data[:i:i], data[i+j+1:]...)
+			},
+		},
+		{
+			name: "truncated", plaintext: "hello", recipients: both, identity: alice, wantErr: errAny,
+			tamper: func(data []byte) []byte {
+				return data[:len(data)-20]
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := Encrypt([]byte(tt.plaintext), tt.recipients)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !IsEncrypted(data) {
+				t.Fatal("IsEncrypted = false for encrypted data")
+			}
+			if bytes.Contains(data, []byte(tt.plaintext)) && tt.plaintext != "" {
+				t.Error("ciphertext contains the plaintext")
+			}
+			if tt.tamper != nil {
+				data = tt.tamper(data)
+			}
+
+			got, err := Decrypt(data, tt.identity)
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Fatalf("Decrypt: %v", err)
+			case tt.wantErr == nil && string(got) != tt.plaintext:
+				t.Errorf("Decrypt = %q, want %q", got, tt.plaintext)
+			case tt.wantErr == errAny && err == nil:
+				t.Errorf("Decrypt succeeded, want an error")
+			case tt.wantErr != nil && tt.wantErr != errAny && !errors.Is(err, tt.wantErr):
+				t.Errorf("Decrypt error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// errAny stands for any error in test tables
+var errAny = errors.New("any error")
+
+func TestEncryptIsRandomized(t *testing.T) {
+	r := mustIdentity(t).Recipient()
+	a, err := Encrypt([]byte("same"), []*Recipient{r})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Encrypt([]byte("same"), []*Recipient{r})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(a, b) {
+		t.Error("encrypting twice gave the same ciphertext")
+	}
+}
+
+func TestEncryptWithoutRecipients(t *testing.T) {
+	if _, err := Encrypt([]byte("x"), nil); err == nil {
+		t.Error("Encrypt with no recipients succeeded")
+	}
+}
+
+func TestRecipientTags(t *testing.T) {
+	alice, bob := mustIdentity(t), mustIdentity(t)
+	data, err := Encrypt([]byte("x"), []*Recipient{bob.Recipient(), alice.Recipient()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags, err := RecipientTags(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{alice.Recipient().Tag(), bob.Recipient().Tag()}
+	if want[0] > want[1] {
+		want[0], want[1] = want[1], want[0]
+	}
+	if len(tags) != 2 || tags[0] != want[0] || tags[1] != want[1] {
+		t.Errorf("RecipientTags = %v, want %v", tags, want)
+	}
+}
+
+func TestKeysRoundTrip(t *testing.T) {
+	id := mustIdentity(t)
+	path := filepath.Join(t.TempDir(), "identity.key")
+	if err := id.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadIdentity(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.String() != id.String() {
+		t.Error("loaded identity differs from the saved one")
+	}
+
+	r, err := ParseRecipient(id.Recipient().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Tag() != id.Recipient().Tag() {
+		t.Error("parsed public key differs")
+	}
+
+	for _, bad := range []string{"", "nonsense", publicPrefix + "!!!", publicPrefix + "AAAA"} {
+		if _, err := ParseRecipient(bad); err == nil {
+			t.Errorf("ParseRecipient(%q) succeeded", bad)
+		}
+	}
+}
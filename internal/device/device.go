@@ -10,17 +10,21 @@ import (
 
 // Info holds information about the current device
 type Info struct {
-	Serial   string
-	Name     string
-	Platform string
-	Hostname string
-	Username string
-	Arch     string
+	Serial      string
+	Name        string
+	Platform    string
+	Hostname    string
+	Username    string
+	Arch        string
+	Source      string   // Where Serial came from, one of the Source constants
+	Environment string   // EnvContainer, EnvWSL, EnvVM or "" on bare metal
+	PreviousIDs []string // Identities older versions of metarepo gave this device
 }
 
 // GetCurrentDevice returns information about the current device
 func GetCurrentDevice() (*Info, error) {
-	serial, err := GetSerialNumber()
+	env := detectEnvironment()
+	serial, source, err := identify(env)
 	if err != nil {
 		return nil, err
 	}
@@ -32,11 +36,14 @@ func GetCurrentDevice() (*Info, error) {
 	}
 
 	return &Info{
-		Serial:   serial,
-		Platform: runtime.GOOS,
-		Hostname: hostname,
-		Username: username,
-		Arch:     runtime.GOARCH,
+		Serial:      serial,
+		Platform:    runtime.GOOS,
+		Hostname:    hostname,
+		Username:    username,
+		Arch:        runtime.GOARCH,
+		Source:      source,
+		Environment: env,
+		PreviousIDs: previousIDs(source),
 	}, nil
 }
 
@@ -0,0 +1,80 @@
+package device
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Environments a device can run in, besides bare metal
+const (
+	EnvContainer = "container"
+	EnvWSL       = "wsl"
+	EnvVM        = "vm"
+)
+
+// hypervisorVendors appear in the DMI vendor or product name of VMs
+var hypervisorVendors = []string{
+	"qemu", "kvm", "vmware", "virtualbox", "innotek", "xen", "bochs",
+	"parallels", "microsoft corporation virtual machine", "amazon ec2",
+	"google compute engine", "openstack", "hvm domu",
+}
+
+// detectEnvironment reports whether metarepo runs in a container, under
+// WSL or in a virtual machine, or "" if none was detected
+func detectEnvironment() string {
+	switch runtime.GOOS {
+	case "linux":
+		if inContainer() {
+			return EnvContainer
+		}
+		if release := strings.ToLower(readTrimmed("/proc/sys/kernel/osrelease")); strings.Contains(release, "microsoft") || os.Getenv("WSL_DISTRO_NAME") != "" {
+			return EnvWSL
+		}
+		if inLinuxVM() {
+			return EnvVM
+		}
+	case "darwin":
+		if output, err := exec.Command("sysctl", "-n", "kern.hv_vmm_present").Output(); err == nil && strings.TrimSpace(string(output)) == "1" {
+			return EnvVM
+		}
+	}
+	return ""
+}
+
+func inContainer() bool {
+	for _, path := range []string{"/.dockerenv", "/run/.containerenv"} {
+		if _, err := os.Stat(path); err == nil {
+			return true
+		}
+	}
+	if os.Getenv("container") != "" || os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		return true
+	}
+
+	cgroup := readTrimmed("/proc/1/cgroup")
+	for _, name := range []string{"docker", "kubepods", "containerd", "lxc", "podman"} {
+		if strings.Contains(cgroup, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func inLinuxVM() bool {
+	dmi := strings.ToLower(readTrimmed("/sys/class/dmi/id/sys_vendor") + " " + readTrimmed("/sys/class/dmi/id/product_name"))
+	for _, vendor := range hypervisorVendors {
+		if strings.Contains(dmi, vendor) {
+			return true
+		}
+	}
+
+	// Set by the kernel when running under any hypervisor
+	for _, line := range strings.Split(readTrimmed("/proc/cpuinfo"), "\n") {
+		if strings.HasPrefix(line, "flags") {
+			return strings.Contains(line, " hypervisor")
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package device
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/JPlanken/metarepo-cli/internal/fsutil"
+	"github.com/google/uuid"
+)
+
+// EnvDeviceID overrides the device identity, e.g. for CI runners
+const EnvDeviceID = "METAREPO_DEVICE_ID"
+
+// Sources of the device identity, in the order they are tried
+const (
+	SourceEnv       = "env"        // METAREPO_DEVICE_ID
+	SourceHardware  = "hardware"   // Hardware serial number
+	SourceMachineID = "machine-id" // /etc/machine-id
+	SourceGenerated = "generated"  // UUID stored in ~/.config/metarepo/device-id
+)
+
+// SourceDescription describes an identity source for display
+func SourceDescription(source string) string {
+	switch source {
+	case SourceEnv:
+		return EnvDeviceID + " environment variable"
+	case SourceHardware:
+		return "hardware serial number"
+	case SourceMachineID:
+		return "machine-id"
+	case SourceGenerated:
+		return "generated ID in ~/.config/metarepo/device-id"
+	default:
+		return source
+	}
+}
+
+// identify returns a stable ID for this device and its source. Containers
+// and VMs skip the machine-id, which is shared by images and cloned
+// machines; containers also skip the hardware serial, which is the host's.
+func identify(env string) (string, string, error) {
+	if id := os.Getenv(EnvDeviceID); id != "" {
+		return id, SourceEnv, nil
+	}
+
+	if env != EnvContainer {
+		if serial, err := GetSerialNumber(); err == nil {
+			return serial, SourceHardware, nil
+		}
+	}
+
+	if env != EnvContainer && env != EnvVM {
+		if id, err := GetMachineID(); err == nil {
+			return id, SourceMachineID, nil
+		}
+	}
+
+	id, err := generatedID()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to determine device identity: %w", err)
+	}
+	return id, SourceGenerated, nil
+}
+
+// previousIDs returns identities older versions of metarepo gave this
+// device, which a registry may still hold. They used the machine-id on
+// Linux whenever product_serial was unreadable, in containers and VMs too,
+// and before board_serial.
+func previousIDs(source string) []string {
+	if runtime.GOOS != "linux" || source == SourceEnv || source == SourceMachineID {
+		return nil
+	}
+	if id, err := GetMachineID(); err == nil {
+		return []string{id}
+	}
+	return nil
+}
+
+// generatedID returns the UUID stored in ~/.config/metarepo/device-id,
+// creating it on first use
+func generatedID() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find home directory: %w", err)
+	}
+	path := filepath.Join(home, ".config", "metarepo", "device-id")
+
+	if id := readTrimmed(path); id != "" {
+		return id, nil
+	}
+
+	id := uuid.New().String()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	if err := fsutil.WriteFile(path, []byte(id+"\n"), 0644); err != nil {
+		return "", err
+	}
+	return id, nil
+}
@@ -2,8 +2,10 @@ package device
 
 import (
 	"fmt"
+	"os"
 	"os/exec"
 	"runtime"
+	"slices"
 	"strings"
 )
 
@@ -38,7 +40,9 @@ func getMacSerial() (string, error) {
 			if len(parts) == 2 {
 				serial := strings.TrimSpace(parts[1])
 				serial = strings.Trim(serial, "\"")
-				return serial, nil
+				if validSerial(serial) {
+					return serial, nil
+				}
 			}
 		}
 	}
@@ -46,38 +50,54 @@ func getMacSerial() (string, error) {
 	return "", fmt.Errorf("could not find serial number in ioreg output")
 }
 
-// getLinuxSerial returns the serial number on Linux
+// getLinuxSerial returns the DMI serial number on Linux. The DMI files are
+// usually only readable by root.
 func getLinuxSerial() (string, error) {
-	// Try multiple methods to get a unique identifier
-
-	// Method 1: DMI product serial
-	cmd := exec.Command("cat", "/sys/class/dmi/id/product_serial")
-	if output, err := cmd.Output(); err == nil {
-		serial := strings.TrimSpace(string(output))
-		if serial != "" && serial != "To Be Filled By O.E.M." {
+	for _, path := range []string{"/sys/class/dmi/id/product_serial", "/sys/class/dmi/id/board_serial"} {
+		if serial := readTrimmed(path); validSerial(serial) {
 			return serial, nil
 		}
 	}
+	return "", fmt.Errorf("could not determine serial number on Linux")
+}
 
-	// Method 2: Machine ID
-	cmd = exec.Command("cat", "/etc/machine-id")
-	if output, err := cmd.Output(); err == nil {
-		machineID := strings.TrimSpace(string(output))
-		if machineID != "" {
-			return machineID, nil
+// GetMachineID returns the systemd/D-Bus machine ID on Linux
+func GetMachineID() (string, error) {
+	for _, path := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id"} {
+		if id := readTrimmed(path); id != "" {
+			return id, nil
 		}
 	}
+	return "", fmt.Errorf("no machine-id found")
+}
 
-	// Method 3: Board serial
-	cmd = exec.Command("cat", "/sys/class/dmi/id/board_serial")
-	if output, err := cmd.Output(); err == nil {
-		serial := strings.TrimSpace(string(output))
-		if serial != "" && serial != "To Be Filled By O.E.M." {
-			return serial, nil
-		}
+// placeholderSerials are values firmware reports when no serial was set
+var placeholderSerials = []string{
+	"to be filled by o.e.m.",
+	"default string",
+	"system serial number",
+	"not specified",
+	"not applicable",
+	"none",
+	"0",
+	"0123456789",
+}
+
+// validSerial reports whether serial looks like a real serial number
+func validSerial(serial string) bool {
+	if serial == "" {
+		return false
 	}
+	return !slices.Contains(placeholderSerials, strings.ToLower(serial))
+}
 
-	return "", fmt.Errorf("could not determine serial number on Linux")
+// readTrimmed returns the trimmed content of a file, or "" if it can't be read
+func readTrimmed(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
 }
 
 // getWindowsSerial returns the serial number on Windows
@@ -92,7 +112,7 @@ func getWindowsSerial() (string, error) {
 	for _, line := range lines {
 		line = strings.TrimSpace(line)
 		// Skip header and empty lines
-		if line != "" && line != "SerialNumber" {
+		if line != "" && line != "SerialNumber" && validSerial(line) {
 			return line, nil
 		}
 	}
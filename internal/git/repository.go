@@ -1,6 +1,7 @@
 package git
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -168,6 +169,157 @@ func Clone(url, destPath string) error {
 	return cmd.Run()
 }
 
+// CloneQuiet clones a repository without streaming git's output, so it can
+// be run concurrently. On failure the error includes git's output.
+func CloneQuiet(url, destPath string) error {
+	_, err := runGitCommandCombined("", "clone", "--quiet", url, destPath)
+	return err
+}
+
+// Init initializes a new repository whose initial branch is branch
+func Init(repoPath, branch string) error {
+	if _, err := runGitCommandCombined(repoPath, "init", "--quiet"); err != nil {
+		return err
+	}
+	_, err := runGitCommandCombined(repoPath, "symbolic-ref", "HEAD", "refs/heads/"+branch)
+	return err
+}
+
+// SetRemote adds the named remote, or updates its URL if it already exists
+func SetRemote(repoPath, remote, url string) error {
+	current, err := runGitCommand(repoPath, "remote", "get-url", remote)
+	if err != nil {
+		_, err = runGitCommandCombined(repoPath, "remote", "add", remote, url)
+		return err
+	}
+	if strings.TrimSpace(current) == url {
+		return nil
+	}
+	_, err = runGitCommandCombined(repoPath, "remote", "set-url", remote, url)
+	return err
+}
+
+// CommitAll stages all changes and commits them. It returns false if there
+// was nothing to commit.
+func CommitAll(repoPath, message string) (bool, error) {
+	if _, err := runGitCommandCombined(repoPath, "add", "-A"); err != nil {
+		return false, err
+	}
+
+	status, err := runGitCommand(repoPath, "status", "--porcelain")
+	if err != nil {
+		return false, err
+	}
+	if strings.TrimSpace(status) == "" {
+		return false, nil
+	}
+
+	if _, err := runGitCommandCombined(repoPath, "commit", "--quiet", "-m", message); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// PushBranch pushes HEAD to branch on the remote
+func PushBranch(repoPath, remote, branch string) error {
+	_, err := runGitCommandCombined(repoPath, "push", "--quiet", remote, "HEAD:refs/heads/"+branch)
+	return err
+}
+
+// Rebase fetches branch from the remote and rebases local commits onto it.
+// Uncommitted changes are stashed and reapplied. If the rebase conflicts it
+// is aborted, leaving HEAD where it was. A branch missing on the remote is
+// not an error. It returns whether HEAD moved.
+func Rebase(repoPath, remote, branch string) (bool, error) {
+	exists, err := remoteBranchExists(repoPath, remote, branch)
+	if err != nil || !exists {
+		return false, err
+	}
+
+	before, _ := runGitCommand(repoPath, "rev-parse", "HEAD")
+
+	if _, err := runGitCommandCombined(repoPath, "fetch", "--quiet", remote, branch); err != nil {
+		return false, err
+	}
+	if _, err := runGitCommandCombined(repoPath, "rebase", "--autostash", "--quiet", "FETCH_HEAD"); err != nil {
+		runGitCommandCombined(repoPath, "rebase", "--abort")
+		return false, err
+	}
+
+	after, _ := runGitCommand(repoPath, "rev-parse", "HEAD")
+	return before != after, nil
+}
+
+// ErrDiverged is returned by FastForward when local and remote commits
+// have diverged
+var ErrDiverged = errors.New("local commits have diverged")
+
+// FastForward fetches branch from the remote and fast-forwards HEAD to it.
+// It fails without changing anything if HEAD has commits the remote does
+// not have and the remote has commits HEAD does not have. A branch missing
+// on the remote is not an error. It returns whether HEAD moved.
+func FastForward(repoPath, remote, branch string) (bool, error) {
+	exists, err := remoteBranchExists(repoPath, remote, branch)
+	if err != nil || !exists {
+		return false, err
+	}
+
+	if _, err := runGitCommandCombined(repoPath, "fetch", "--quiet", remote, branch); err != nil {
+		return false, err
+	}
+
+	_, err = runGitCommand(repoPath, "rev-parse", "--verify", "--quiet", "HEAD")
+	unborn := err != nil
+	if !unborn {
+		if isAncestor(repoPath, "FETCH_HEAD", "HEAD") {
+			return false, nil
+		}
+		if !isAncestor(repoPath, "HEAD", "FETCH_HEAD") {
+			return false, fmt.Errorf("%w from %s/%s", ErrDiverged, remote, branch)
+		}
+	}
+
+	if _, err := runGitCommandCombined(repoPath, "merge", "--ff-only", "--quiet", "FETCH_HEAD"); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// CheckoutRemote fetches branch from the remote and checks it out in a
+// repository without commits, replacing untracked files the remote also
+// has. A branch missing on the remote is not an error. It returns whether
+// anything was checked out.
+func CheckoutRemote(repoPath, remote, branch string) (bool, error) {
+	exists, err := remoteBranchExists(repoPath, remote, branch)
+	if err != nil || !exists {
+		return false, err
+	}
+
+	if _, err := runGitCommandCombined(repoPath, "fetch", "--quiet", remote, branch); err != nil {
+		return false, err
+	}
+	if _, err := runGitCommandCombined(repoPath, "checkout", "--quiet", "--force", "-B", branch, "FETCH_HEAD"); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// isAncestor reports whether commit a is an ancestor of, or equal to, b
+func isAncestor(repoPath, a, b string) bool {
+	_, err := runGitCommand(repoPath, "merge-base", "--is-ancestor", a, b)
+	return err == nil
+}
+
+// remoteBranchExists reports whether branch exists on the remote
+func remoteBranchExists(repoPath, remote, branch string) (bool, error) {
+	_, err := runGitCommandCombined(repoPath, "ls-remote", "--exit-code", "--heads", remote, "refs/heads/"+branch)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 2 {
+		return false, nil
+	}
+	return err == nil, err
+}
+
 // runGitCommand runs a git command in the specified directory
 func runGitCommand(repoPath string, args ...string) (string, error) {
 	cmd := exec.Command("git", args...)
@@ -178,3 +330,18 @@ func runGitCommand(repoPath string, args ...string) (string, error) {
 	}
 	return string(output), nil
 }
+
+// runGitCommandCombined runs a git command and returns its combined output.
+// On failure the error includes git's output.
+func runGitCommandCombined(repoPath string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = repoPath
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(output)); msg != "" {
+			return "", fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", err
+	}
+	return string(output), nil
+}
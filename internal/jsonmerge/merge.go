@@ -0,0 +1,481 @@
+// Package jsonmerge merges JSON and JSONC settings files three ways.
+//
+// Changes between the base and the remote version are applied to the local
+// text as edits, so the local formatting and comments are kept. Objects are
+// merged per property and arrays per element (as sets); anything else is
+// replaced as a whole. A property changed differently on both sides is a
+// conflict.
+package jsonmerge
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Extensions lists the file extensions that are merged
+var Extensions = []string{".json", ".jsonc", ".code-workspace"}
+
+// Supported reports whether a file is merged structurally
+func Supported(filePath string) bool {
+	ext := strings.ToLower(path.Ext(filePath))
+	for _, e := range Extensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// Conflict is a value changed differently on both sides
+type Conflict struct {
+	Path   []string
+	Local  string // compact JSON of the local value, "" if deleted
+	Remote string // compact JSON of the remote value, "" if deleted
+}
+
+// Key returns the conflict's property path, joined with "/"
+func (c Conflict) Key() string {
+	if len(c.Path) == 0 {
+		return "(root)"
+	}
+	return strings.Join(c.Path, "/")
+}
+
+// Result is the outcome of a merge
+type Result struct {
+	Data      []byte     // the merged local text
+	Applied   int        // remote changes applied
+	Conflicts []Conflict // values changed on both sides
+}
+
+// Merge merges the changes from base to remote into local. An empty base is
+// treated as an empty document, so only values present on both sides with
+// different content conflict. Conflicts keep the local value unless
+// preferRemote is set.
+func Merge(base, local, remote []byte, preferRemote bool) (*Result, error) {
+	remoteRoot, err := Parse(remote)
+	if err != nil {
+		return nil, fmt.Errorf("remote: %w", err)
+	}
+	localRoot, err := Parse(local)
+	if err != nil {
+		return nil, fmt.Errorf("local: %w", err)
+	}
+
+	if len(bytes.TrimSpace(base)) == 0 {
+		base = []byte("{}")
+		if remoteRoot.Kind == Array {
+			base = []byte("[]")
+		}
+	}
+	baseRoot, err := Parse(base)
+	if err != nil {
+		return nil, fmt.Errorf("base: %w", err)
+	}
+
+	localDoc := document{root: localRoot, data: local}
+	remoteDoc := document{root: remoteRoot, data: remote}
+	baseDoc := document{root: baseRoot, data: base}
+
+	var localChanges, remoteChanges []change
+	diff(baseDoc, baseRoot, localDoc, localRoot, nil, &localChanges)
+	diff(baseDoc, baseRoot, remoteDoc, remoteRoot, nil, &remoteChanges)
+
+	result := &Result{}
+	var apply []change
+	resolved := make(map[string]bool)
+
+	for _, rc := range remoteChanges {
+		conflictPath, same := rc.path, false
+		conflicting := false
+		for _, lc := range localChanges {
+			if !overlaps(lc, rc) {
+				continue
+			}
+			if samePath(lc.path, rc.path) && lc.op == rc.op && lc.canon == rc.canon {
+				same = true
+				break
+			}
+			conflicting = true
+			if len(lc.path) < len(conflictPath) {
+				conflictPath = lc.path
+			}
+		}
+		if same {
+			continue
+		}
+		if !conflicting {
+			apply = append(apply, rc)
+			result.Applied++
+			continue
+		}
+
+		key := strings.Join(conflictPath, "\x00")
+		if resolved[key] {
+			continue
+		}
+		resolved[key] = true
+
+		result.Conflicts = append(result.Conflicts, Conflict{
+			Path:   conflictPath,
+			Local:  localDoc.canonicalAt(conflictPath),
+			Remote: remoteDoc.canonicalAt(conflictPath),
+		})
+		if preferRemote {
+			apply = append(apply, remoteDoc.replacement(conflictPath))
+		}
+	}
+
+	data := local
+	for _, c := range apply {
+		if data, err = c.apply(data); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := Parse(data); err != nil {
+		return nil, fmt.Errorf("merged result is invalid: %w", err)
+	}
+
+	result.Data = data
+	return result, nil
+}
+
+// document is a parsed file
+type document struct {
+	root *Node
+	data []byte
+}
+
+// lookup returns the value at path, or nil
+func (d document) lookup(p []string) *Node {
+	n := d.root
+	for _, key := range p {
+		if n.Kind != Object {
+			return nil
+		}
+		m := n.find(key)
+		if m == nil {
+			return nil
+		}
+		n = m.Value
+	}
+	return n
+}
+
+// canonicalAt returns the compact JSON of the value at path, or ""
+func (d document) canonicalAt(p []string) string {
+	if n := d.lookup(p); n != nil {
+		return canonical(n, d.data)
+	}
+	return ""
+}
+
+// replacement returns the change setting path to this document's value
+func (d document) replacement(p []string) change {
+	n := d.lookup(p)
+	if n == nil {
+		return change{path: p, op: opDelete}
+	}
+	return d.set(p, n)
+}
+
+// set returns a change setting path to n
+func (d document) set(p []string, n *Node) change {
+	return change{
+		path:   p,
+		op:     opSet,
+		text:   string(d.data[n.Start:n.End]),
+		indent: lineIndent(d.data, n.Start),
+		canon:  canonical(n, d.data),
+	}
+}
+
+type op int
+
+const (
+	opSet    op = iota // set the value at path
+	opDelete           // delete the property at path
+	opAdd              // add an element to the array at path
+	opRemove           // remove an element from the array at path
+)
+
+// change is an edit to a document
+type change struct {
+	path   []string
+	op     op
+	text   string // value text for opSet and opAdd
+	indent string // indentation of the line text started on
+	canon  string // canonical value, or element for opAdd and opRemove
+}
+
+// diff collects the changes from base to side under path
+func diff(baseDoc document, base *Node, sideDoc document, side *Node, p []string, out *[]change) {
+	switch {
+	case base.Kind == Object && side.Kind == Object:
+		for _, m := range side.Members {
+			child := appendPath(p, m.Key)
+			if bm := base.find(m.Key); bm != nil {
+				if side.find(m.Key) == m {
+					diff(baseDoc, bm.Value, sideDoc, m.Value, child, out)
+				}
+			} else if side.find(m.Key) == m {
+				*out = append(*out, sideDoc.set(child, m.Value))
+			}
+		}
+		for _, bm := range base.Members {
+			if side.find(bm.Key) == nil && base.find(bm.Key) == bm {
+				*out = append(*out, change{path: appendPath(p, bm.Key), op: opDelete})
+			}
+		}
+
+	case base.Kind == Array && side.Kind == Array:
+		baseItems := elements(baseDoc, base)
+		sideItems := elements(sideDoc, side)
+		for _, m := range side.Members {
+			canon := canonical(m.Value, sideDoc.data)
+			if !baseItems[canon] {
+				*out = append(*out, change{
+					path:   p,
+					op:     opAdd,
+					text:   string(sideDoc.data[m.Value.Start:m.Value.End]),
+					indent: lineIndent(sideDoc.data, m.Value.Start),
+					canon:  canon,
+				})
+			}
+		}
+		for _, m := range base.Members {
+			canon := canonical(m.Value, baseDoc.data)
+			if !sideItems[canon] {
+				*out = append(*out, change{path: p, op: opRemove, canon: canon})
+			}
+		}
+
+	default:
+		if canonical(base, baseDoc.data) != canonical(side, sideDoc.data) {
+			*out = append(*out, sideDoc.set(p, side))
+		}
+	}
+}
+
+// elements returns the set of canonical array elements
+func elements(d document, n *Node) map[string]bool {
+	set := make(map[string]bool, len(n.Members))
+	for _, m := range n.Members {
+		set[canonical(m.Value, d.data)] = true
+	}
+	return set
+}
+
+// overlaps reports whether two changes touch the same value. Element
+// changes to the same array never overlap each other.
+func overlaps(a, b change) bool {
+	if isElementOp(a) && isElementOp(b) && samePath(a.path, b.path) {
+		return false
+	}
+	return hasPrefix(a.path, b.path) || hasPrefix(b.path, a.path)
+}
+
+func isElementOp(c change) bool {
+	return c.op == opAdd || c.op == opRemove
+}
+
+// apply applies the change to data
+func (c change) apply(data []byte) ([]byte, error) {
+	root, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.op == opSet && len(c.path) == 0 {
+		return []byte(c.text), nil
+	}
+
+	target := c.path
+	if c.op == opSet || c.op == opDelete {
+		target = c.path[:len(c.path)-1]
+	}
+	n := document{root: root, data: data}.lookup(target)
+	if n == nil {
+		return nil, fmt.Errorf("cannot apply change at %s: parent is missing", strings.Join(c.path, "/"))
+	}
+
+	switch c.op {
+	case opSet:
+		if n.Kind != Object {
+			return nil, fmt.Errorf("cannot apply change at %s: parent is not an object", strings.Join(c.path, "/"))
+		}
+		key := c.path[len(c.path)-1]
+		if m := n.find(key); m != nil {
+			value := reindent(c.text, c.indent, lineIndent(data, m.Start))
+			return splice(data, m.Value.Start, m.Value.End, value), nil
+		}
+		name, _ := json.Marshal(key)
+		return insertMember(data, n, string(name)+": ", c), nil
+
+	case opDelete:
+		if n.Kind != Object {
+			return data, nil
+		}
+		key := c.path[len(c.path)-1]
+		for i := len(n.Members) - 1; i >= 0; i-- {
+			if n.Members[i].Key == key {
+				return removeMember(data, n, i), nil
+			}
+		}
+		return data, nil
+
+	case opAdd:
+		if n.Kind != Array {
+			return nil, fmt.Errorf("cannot apply change at %s: not an array", strings.Join(c.path, "/"))
+		}
+		if elements(document{root: n, data: data}, n)[c.canon] {
+			return data, nil
+		}
+		return insertMember(data, n, "", c), nil
+
+	case opRemove:
+		if n.Kind != Array {
+			return data, nil
+		}
+		for i, m := range n.Members {
+			if canonical(m.Value, data) == c.canon {
+				return removeMember(data, n, i), nil
+			}
+		}
+		return data, nil
+	}
+
+	return data, nil
+}
+
+// insertMember appends a property or element to the container n, following
+// the container's layout
+func insertMember(data []byte, n *Node, prefix string, c change) []byte {
+	multiline := bytes.IndexByte(data[n.Start:n.End], '\n') >= 0
+
+	if len(n.Members) == 0 {
+		outer := lineIndent(data, n.Start)
+		if n.Kind == Array && !multiline {
+			return splice(data, n.Start+1, n.End-1, prefix+reindent(c.text, c.indent, outer))
+		}
+		inner := outer + indentUnit(data)
+		text := "\n" + inner + prefix + reindent(c.text, c.indent, inner) + "\n" + outer
+		return splice(data, n.Start+1, n.End-1, text)
+	}
+
+	last := n.Members[len(n.Members)-1]
+	if !multiline {
+		text := prefix + reindent(c.text, c.indent, lineIndent(data, last.Start))
+		if last.Comma >= 0 {
+			return splice(data, last.Comma+1, last.Comma+1, " "+text+",")
+		}
+		return splice(data, last.Value.End, last.Value.End, ", "+text)
+	}
+
+	indent := lineIndent(data, last.Start)
+	text := prefix + reindent(c.text, c.indent, indent)
+	if last.Comma >= 0 {
+		return splice(data, last.Comma+1, last.Comma+1, "\n"+indent+text+",")
+	}
+	return splice(data, last.Value.End, last.Value.End, ",\n"+indent+text)
+}
+
+// removeMember removes the i-th property or element of n, with its comma
+// and, if it stood on lines of its own, those lines
+func removeMember(data []byte, n *Node, i int) []byte {
+	m := n.Members[i]
+	start, end := m.Start, m.Value.End
+	if m.Comma >= 0 {
+		end = m.Comma + 1
+	} else if i > 0 && n.Members[i-1].Comma >= 0 {
+		// Last member: drop the comma before it instead
+		return splice(data, n.Members[i-1].Comma, end, "")
+	}
+
+	lineStart := bytes.LastIndexByte(data[:start], '\n') + 1
+	if len(bytes.TrimSpace(data[lineStart:start])) == 0 {
+		rest := data[end:]
+		lineEnd := bytes.IndexByte(rest, '\n')
+		if lineEnd >= 0 {
+			trailing := bytes.TrimSpace(rest[:lineEnd])
+			if len(trailing) == 0 || bytes.HasPrefix(trailing, []byte("//")) {
+				start, end = lineStart, end+lineEnd+1
+			}
+		}
+	} else {
+		// Inline: also drop the space that separated it from the next member
+		for end < len(data) && (data[end] == ' ' || data[end] == '\t') {
+			end++
+		}
+	}
+
+	return splice(data, start, end, "")
+}
+
+// splice replaces data[start:end] with text
+func splice(data []byte, start, end int, text string) []byte {
+	out := make([]byte, 0, len(data)-(end-start)+len(text))
+	out = append(out, data[:start]...)
+	out = append(out, text...)
+	return append(out, data[end:]...)
+}
+
+// lineIndent returns the leading whitespace of the line containing offset
+func lineIndent(data []byte, offset int) string {
+	start := bytes.LastIndexByte(data[:offset], '\n') + 1
+	end := start
+	for end < len(data) && (data[end] == ' ' || data[end] == '\t') {
+		end++
+	}
+	return string(data[start:end])
+}
+
+// indentUnit guesses the indentation step of a document
+func indentUnit(data []byte) string {
+	for _, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed != "" && len(trimmed) < len(line) {
+			return line[:len(line)-len(trimmed)]
+		}
+	}
+	return "  "
+}
+
+// reindent moves the continuation lines of text from one base indentation
+// to another
+func reindent(text, from, to string) string {
+	if from == to || !strings.Contains(text, "\n") {
+		return text
+	}
+	lines := strings.Split(text, "\n")
+	for i := 1; i < len(lines); i++ {
+		if strings.HasPrefix(lines[i], from) {
+			lines[i] = to + strings.TrimPrefix(lines[i], from)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func appendPath(p []string, key string) []string {
+	return append(append([]string{}, p...), key)
+}
+
+func samePath(a, b []string) bool {
+	return len(a) == len(b) && hasPrefix(a, b)
+}
+
+// hasPrefix reports whether prefix is an ancestor of (or equal to) p
+func hasPrefix(p, prefix []string) bool {
+	if len(prefix) > len(p) {
+		return false
+	}
+	for i := range prefix {
+		if p[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,208 @@
+package jsonmerge
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name         string
+		base         string
+		local        string
+		remote       string
+		preferRemote bool
+		want         string
+		applied      int
+		conflicts    []string // conflict keys
+	}{
+		{
+			name:    "remote adds a key",
+			base:    `{"a": 1}`,
+			local:   `{"a": 1}`,
+			remote:  `{"a": 1, "b": 2}`,
+			want:    `{"a": 1, "b": 2}`,
+			applied: 1,
+		},
+		{
+			name:    "remote changes a value, local another",
+			base:    `{"a": 1, "b": 1}`,
+			local:   `{"a": 2, "b": 1}`,
+			remote:  `{"a": 1, "b": 3}`,
+			want:    `{"a": 2, "b": 3}`,
+			applied: 1,
+		},
+		{
+			name:    "remote deletes a key",
+			base:    `{"a": 1, "b": 2}`,
+			local:   `{"a": 1, "b": 2}`,
+			remote:  `{"a": 1}`,
+			want:    `{"a": 1}`,
+			applied: 1,
+		},
+		{
+			name:   "both delete the same key",
+			base:   `{"a": 1, "b": 2}`,
+			local:  `{"a": 1}`,
+			remote: `{"a": 1}`,
+			want:   `{"a": 1}`,
+		},
+		{
+			name:    "local keeps comments and trailing commas",
+			base:    `{"a": 1}`,
+			local:   "{\n  // editor\n  \"a\": 1,\n}",
+			remote:  `{"a": 1, "b": true}`,
+			want:    "{\n  // editor\n  \"a\": 1,\n  \"b\": true,\n}",
+			applied: 1,
+		},
+		{
+			name:    "remote with comments",
+			base:    `{"a": 1}`,
+			local:   `{"a": 1}`,
+			remote:  "{\n  /* changed */ \"a\": 2, // two\n}",
+			want:    `{"a": 2}`,
+			applied: 1,
+		},
+		{
+			name:    "nested objects merge per key",
+			base:    `{"editor": {"fontSize": 12, "tabSize": 2}}`,
+			local:   `{"editor": {"fontSize": 14, "tabSize": 2}}`,
+			remote:  `{"editor": {"fontSize": 12, "tabSize": 4, "wrap": "on"}}`,
+			want:    `{"editor": {"fontSize": 14, "tabSize": 4, "wrap": "on"}}`,
+			applied: 2,
+		},
+		{
+			name:    "array elements merge as sets",
+			base:    `{"x": ["a", "b"]}`,
+			local:   `{"x": ["a", "b", "c"]}`,
+			remote:  `{"x": ["b", "d"]}`,
+			want:    `{"x": ["b", "c", "d"]}`,
+			applied: 2,
+		},
+		{
+			name:    "array replaced by a scalar",
+			base:    `{"x": ["a"], "y": 1}`,
+			local:   `{"x": ["a"], "y": 2}`,
+			remote:  `{"x": "a", "y": 1}`,
+			want:    `{"x": "a", "y": 2}`,
+			applied: 1,
+		},
+		{
+			name:    "scalar replaced by an array",
+			base:    `{"x": "a"}`,
+			local:   `{"x": "a"}`,
+			remote:  `{"x": ["a", "b"]}`,
+			want:    `{"x": ["a", "b"]}`,
+			applied: 1,
+		},
+		{
+			name:      "conflict keeps local",
+			base:      `{"a": 1}`,
+			local:     `{"a": 2}`,
+			remote:    `{"a": 3}`,
+			want:      `{"a": 2}`,
+			conflicts: []string{"a"},
+		},
+		{
+			name:         "conflict prefers remote",
+			base:         `{"a": 1}`,
+			local:        `{"a": 2}`,
+			remote:       `{"a": 3}`,
+			preferRemote: true,
+			want:         `{"a": 3}`,
+			conflicts:    []string{"a"},
+		},
+		{
+			name:      "nested conflict with a local delete",
+			base:      `{"e": {"a": 1}}`,
+			local:     `{}`,
+			remote:    `{"e": {"a": 2}}`,
+			want:      `{}`,
+			conflicts: []string{"e"},
+		},
+		{
+			name:      "no base: keys on both sides conflict",
+			local:     `{"a": 1, "b": 1}`,
+			remote:    `{"a": 2, "c": 1}`,
+			want:      `{"a": 1, "b": 1, "c": 1}`,
+			applied:   1,
+			conflicts: []string{"a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Merge([]byte(tt.base), []byte(tt.local), []byte(tt.remote), tt.preferRemote)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(result.Data) != tt.want {
+				t.Errorf("merged:\n%s\nwant:\n%s", result.Data, tt.want)
+			}
+			if result.Applied != tt.applied {
+				t.Errorf("applied = %d, want %d", result.Applied, tt.applied)
+			}
+			var keys []string
+			for _, c := range result.Conflicts {
+				keys = append(keys, c.Key())
+			}
+			if strings.Join(keys, ",") != strings.Join(tt.conflicts, ",") {
+				t.Errorf("conflicts = %v, want %v", keys, tt.conflicts)
+			}
+		})
+	}
+}
+
+func TestMergeKeepsLocalText(t *testing.T) {
+	local := "{\n  // font\n  \"a\": 1,\n  \"b\": [\n    \"x\",\n  ],\n}\n"
+	result, err := Merge([]byte(`{"a": 1}`), []byte(local), []byte(`{"a": 1}`), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(result.Data) != local {
+		t.Errorf("merge without remote changes rewrote the file:\n%s", result.Data)
+	}
+}
+
+func TestMergeInvalid(t *testing.T) {
+	tests := []struct {
+		name                string
+		base, local, remote string
+	}{
+		{"invalid local", `{}`, `{"a": }`, `{}`},
+		{"invalid remote", `{}`, `{}`, `{"a"`},
+		{"invalid base", `[`, `{}`, `{}`},
+	}
+	for _, tt := range tests {
+		if _, err := Merge([]byte(tt.base), []byte(tt.local), []byte(tt.remote), false); err == nil {
+			t.Errorf("%s: Merge succeeded", tt.name)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		ok   bool
+	}{
+		{"object", `{"a": [1, 2.5, true, null, "s"]}`, true},
+		{"line comment", "{\n// c\n\"a\": 1}", true},
+		{"block comment", `{/* c */ "a": 1}`, true},
+		{"trailing comma in object", `{"a": 1,}`, true},
+		{"trailing comma in array", `[1, 2,]`, true},
+		{"escaped quote", `{"a": "say \"hi\""}`, true},
+		{"comment marker in string", `{"url": "http://x//y"}`, true},
+		{"missing value", `{"a": }`, false},
+		{"unclosed object", `{"a": 1`, false},
+		{"unterminated comment", `{"a": 1 /* }`, false},
+		{"trailing text", `{} x`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.data))
+			if (err == nil) != tt.ok {
+				t.Errorf("Parse(%q) error = %v, want ok=%v", tt.data, err, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package jsonmerge
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Kind is the type of a JSON value
+type Kind int
+
+const (
+	Scalar Kind = iota
+	Object
+	Array
+)
+
+// Node is a parsed JSON value with its position in the source text
+type Node struct {
+	Kind    Kind
+	Start   int // byte offset of the value
+	End     int // byte offset just past the value
+	Members []*Member
+}
+
+// Member is an object property or array element
+type Member struct {
+	Key   string // empty for array elements
+	Start int    // byte offset of the key, or of the value for array elements
+	Value *Node
+	Comma int // byte offset of the following comma, or -1
+}
+
+// find returns the last property named key, or nil
+func (n *Node) find(key string) *Member {
+	for i := len(n.Members) - 1; i >= 0; i-- {
+		if n.Members[i].Key == key {
+			return n.Members[i]
+		}
+	}
+	return nil
+}
+
+// Parse parses JSON with comments and trailing commas (JSONC)
+func Parse(data []byte) (*Node, error) {
+	p := &parser{data: data}
+	if bytes.HasPrefix(data, []byte("\xef\xbb\xbf")) {
+		p.pos = 3
+	}
+
+	if err := p.skip(); err != nil {
+		return nil, err
+	}
+	n, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.skip(); err != nil {
+		return nil, err
+	}
+	if p.pos != len(data) {
+		return nil, p.errorf("unexpected content after value")
+	}
+	return n, nil
+}
+
+type parser struct {
+	data []byte
+	pos  int
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	line := bytes.Count(p.data[:p.pos], []byte("\n")) + 1
+	return fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+// skip skips whitespace and comments
+func (p *parser) skip() error {
+	for p.pos < len(p.data) {
+		switch c := p.data[p.pos]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			p.pos++
+		case bytes.HasPrefix(p.data[p.pos:], []byte("//")):
+			for p.pos < len(p.data) && p.data[p.pos] != '\n' {
+				p.pos++
+			}
+		case bytes.HasPrefix(p.data[p.pos:], []byte("/*")):
+			end := bytes.Index(p.data[p.pos+2:], []byte("*/"))
+			if end < 0 {
+				return p.errorf("unterminated comment")
+			}
+			p.pos += end + 4
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (p *parser) value() (*Node, error) {
+	if p.pos >= len(p.data) {
+		return nil, p.errorf("unexpected end of input")
+	}
+
+	switch p.data[p.pos] {
+	case '{':
+		return p.container(Object, '}')
+	case '[':
+		return p.container(Array, ']')
+	case '"':
+		start := p.pos
+		if err := p.str(); err != nil {
+			return nil, err
+		}
+		return &Node{Kind: Scalar, Start: start, End: p.pos}, nil
+	}
+
+	start := p.pos
+	for p.pos < len(p.data) && strings.IndexByte("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789+-.", p.data[p.pos]) >= 0 {
+		p.pos++
+	}
+	if p.pos == start {
+		return nil, p.errorf("unexpected character %q", p.data[p.pos])
+	}
+	if !json.Valid(p.data[start:p.pos]) {
+		return nil, p.errorf("invalid value %q", p.data[start:p.pos])
+	}
+	return &Node{Kind: Scalar, Start: start, End: p.pos}, nil
+}
+
+// container parses an object or array
+func (p *parser) container(kind Kind, closing byte) (*Node, error) {
+	n := &Node{Kind: kind, Start: p.pos}
+	p.pos++
+
+	for {
+		if err := p.skip(); err != nil {
+			return nil, err
+		}
+		if p.pos >= len(p.data) {
+			return nil, p.errorf("unexpected end of input")
+		}
+		if p.data[p.pos] == closing {
+			p.pos++
+			n.End = p.pos
+			return n, nil
+		}
+
+		m := &Member{Start: p.pos, Comma: -1}
+		if kind == Object {
+			if p.data[p.pos] != '"' {
+				return nil, p.errorf("expected property name")
+			}
+			if err := p.str(); err != nil {
+				return nil, err
+			}
+			if err := json.Unmarshal(p.data[m.Start:p.pos], &m.Key); err != nil {
+				return nil, p.errorf("invalid property name: %v", err)
+			}
+			if err := p.skip(); err != nil {
+				return nil, err
+			}
+			if p.pos >= len(p.data) || p.data[p.pos] != ':' {
+				return nil, p.errorf("expected ':'")
+			}
+			p.pos++
+			if err := p.skip(); err != nil {
+				return nil, err
+			}
+		}
+
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		m.Value = value
+		n.Members = append(n.Members, m)
+
+		if err := p.skip(); err != nil {
+			return nil, err
+		}
+		if p.pos < len(p.data) && p.data[p.pos] == ',' {
+			m.Comma = p.pos
+			p.pos++
+		} else if p.pos < len(p.data) && p.data[p.pos] != closing {
+			return nil, p.errorf("expected ',' or '%c'", closing)
+		}
+	}
+}
+
+// str scans a string literal
+func (p *parser) str() error {
+	p.pos++
+	for p.pos < len(p.data) {
+		switch p.data[p.pos] {
+		case '\\':
+			p.pos += 2
+		case '"':
+			p.pos++
+			return nil
+		case '\n':
+			return p.errorf("unterminated string")
+		default:
+			p.pos++
+		}
+	}
+	return p.errorf("unterminated string")
+}
+
+// canonical returns a normalized encoding of a value, independent of
+// formatting, comments and property order
+func canonical(n *Node, data []byte) string {
+	switch n.Kind {
+	case Object:
+		props := make(map[string]string, len(n.Members))
+		for _, m := range n.Members {
+			props[m.Key] = canonical(m.Value, data)
+		}
+		keys := make([]string, 0, len(props))
+		for k := range props {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		var b strings.Builder
+		b.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			key, _ := json.Marshal(k)
+			b.Write(key)
+			b.WriteByte(':')
+			b.WriteString(props[k])
+		}
+		b.WriteByte('}')
+		return b.String()
+
+	case Array:
+		items := make([]string, len(n.Members))
+		for i, m := range n.Members {
+			items[i] = canonical(m.Value, data)
+		}
+		return "[" + strings.Join(items, ",") + "]"
+
+	default:
+		raw := data[n.Start:n.End]
+		if raw[0] == '"' {
+			var s string
+			if err := json.Unmarshal(raw, &s); err == nil {
+				out, _ := json.Marshal(s)
+				return string(out)
+			}
+		}
+		return string(raw)
+	}
+}
@@ -0,0 +1,192 @@
+// Package lock provides an advisory lock file that keeps metarepo processes
+// from changing the same workspace at the same time
+package lock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// StaleAfter is the age after which a lock is considered abandoned even if
+// its owner cannot be checked, e.g. because it was taken on another host
+const StaleAfter = 2 * time.Hour
+
+// unreadableAfter is how long a lock file may stay empty or invalid before
+// it is considered abandoned
+const unreadableAfter = 10 * time.Second
+
+// ErrLocked is returned when another process holds the lock
+var ErrLocked = errors.New("workspace is locked")
+
+// Owner describes the process holding a lock
+type Owner struct {
+	Device   string    `yaml:"device"` // Hostname of the device
+	PID      int       `yaml:"pid"`
+	Command  string    `yaml:"command,omitempty"`
+	Acquired time.Time `yaml:"acquired"`
+}
+
+func (o *Owner) String() string {
+	s := fmt.Sprintf("PID %d on %s since %s", o.PID, o.Device, o.Acquired.Local().Format("2006-01-02 15:04:05"))
+	if o.Command != "" {
+		s = o.Command + " (" + s + ")"
+	}
+	return s
+}
+
+// LockedError is returned by Acquire when the lock is held
+type LockedError struct {
+	Path  string
+	Owner *Owner // nil if the lock file could not be read
+}
+
+func (e *LockedError) Error() string {
+	holder := "another process"
+	if e.Owner != nil {
+		holder = e.Owner.String()
+	}
+	return fmt.Sprintf("%s by %s; wait for it to finish, or remove %s if it is no longer running", ErrLocked, holder, e.Path)
+}
+
+func (e *LockedError) Unwrap() error {
+	return ErrLocked
+}
+
+// Lock is a held lock
+type Lock struct {
+	Path  string
+	Owner Owner
+	Stale *Owner // The abandoned lock that was replaced, if it was readable
+}
+
+// Acquire takes the lock at path for command. It fails with a *LockedError
+// if a live process holds it; stale locks are replaced.
+func Acquire(path, command string) (*Lock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	hostname, _ := os.Hostname()
+	l := &Lock{
+		Path: path,
+		Owner: Owner{
+			Device:   hostname,
+			PID:      os.Getpid(),
+			Command:  command,
+			Acquired: time.Now().UTC(),
+		},
+	}
+	data, err := yaml.Marshal(&l.Owner)
+	if err != nil {
+		return nil, err
+	}
+
+	// A second attempt follows the removal of a stale lock
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, err = f.Write(data)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				os.Remove(path)
+				return nil, err
+			}
+			return l, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		owner, err := readOwner(path)
+		if err != nil {
+			// The owner may be writing it right now; an unreadable lock
+			// that stays that way was left by a crash
+			info, serr := os.Stat(path)
+			if serr != nil || time.Since(info.ModTime()) < unreadableAfter {
+				return nil, &LockedError{Path: path}
+			}
+		} else if !owner.stale(hostname) {
+			return nil, &LockedError{Path: path, Owner: owner}
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to remove stale lock: %w", err)
+		}
+		l.Stale = owner
+	}
+	return nil, &LockedError{Path: path}
+}
+
+// Release removes the lock file if it is still ours
+func (l *Lock) Release() error {
+	owner, err := readOwner(l.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if owner.PID != l.Owner.PID || owner.Device != l.Owner.Device {
+		return nil
+	}
+	return os.Remove(l.Path)
+}
+
+// Read returns the owner of the lock at path, or nil if it is not held
+func Read(path string) (*Owner, error) {
+	owner, err := readOwner(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return owner, err
+}
+
+func readOwner(path string) (*Owner, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var owner Owner
+	if err := yaml.Unmarshal(data, &owner); err != nil {
+		return nil, err
+	}
+	if owner.PID == 0 {
+		return nil, fmt.Errorf("invalid lock file: %s", path)
+	}
+	return &owner, nil
+}
+
+// stale reports whether the lock was abandoned: its process on this host is
+// gone, or it is older than StaleAfter
+func (o *Owner) stale(hostname string) bool {
+	if time.Since(o.Acquired) > StaleAfter {
+		return true
+	}
+	return o.Device == hostname && !processAlive(o.PID)
+}
+
+// processAlive reports whether a process with the given PID exists
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	// On Windows FindProcess opens the process and fails if it is missing
+	if runtime.GOOS == "windows" {
+		if err != nil {
+			return errors.Is(err, os.ErrPermission)
+		}
+		p.Release()
+		return true
+	}
+	if err != nil {
+		return false
+	}
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, os.ErrPermission)
+}
@@ -0,0 +1,245 @@
+// Package secrets finds credentials and other secrets in workspace-config
+// files before they are pushed, and redacts them
+package secrets
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/JPlanken/metarepo-cli/internal/sync"
+)
+
+// AllowMarker on a line suppresses findings that start on it
+const AllowMarker = "metarepo:allow"
+
+// Redacted replaces secrets when a file is redacted
+const Redacted = "[REDACTED]"
+
+// Rule is a secret detector. If the pattern has a group named "secret", only
+// that group is reported and redacted; otherwise the whole match is.
+type Rule struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+// DefaultRules are the built-in detectors
+var DefaultRules = []Rule{
+	{"aws-access-key-id", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"aws-secret-access-key", regexp.MustCompile(`(?i)aws_?secret_?(?:access_?)?key["']?\s*[:=]\s*["']?(?P<secret>[A-Za-z0-9/+]{40})\b`)},
+	{"github-token", regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`)},
+	{"github-pat", regexp.MustCompile(`\bgithub_pat_[A-Za-z0-9_]{22,}`)},
+	{"slack-token", regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+	{"private-key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)},
+}
+
+// jsonValue matches "key": "value" pairs whose value has no whitespace
+var jsonValue = regexp.MustCompile(`"[^"\n]*"\s*:\s*"(?P<secret>[^"\\\s]{20,})"`)
+
+// jsonExtensions are scanned for high-entropy string values
+var jsonExtensions = []string{".json", ".jsonc", ".code-workspace"}
+
+// minEntropy is the Shannon entropy, in bits per character, above which a
+// JSON string value is reported as a likely secret
+const minEntropy = 4.0
+
+// Finding is a potential secret in a file
+type Finding struct {
+	Path  string
+	Line  int
+	Rule  string
+	Start int // byte offset of the secret
+	End   int
+	value string
+}
+
+// Preview returns a masked form of the secret, safe to print
+func (f Finding) Preview() string {
+	if len(f.value) < 8 {
+		return "****"
+	}
+	return f.value[:4] + "****"
+}
+
+// Scanner detects secrets in file contents
+type Scanner struct {
+	rules     []Rule
+	allowlist []*regexp.Regexp
+}
+
+// NewScanner creates a scanner with the built-in rules. Secrets matching one
+// of the allowlist regular expressions are ignored.
+func NewScanner(allowlist []string) (*Scanner, error) {
+	s := &Scanner{rules: DefaultRules}
+	for _, pattern := range allowlist {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowlist pattern %q: %w", pattern, err)
+		}
+		s.allowlist = append(s.allowlist, re)
+	}
+	return s, nil
+}
+
+// Scan returns the potential secrets in data, ordered by position.
+// Binary files are not scanned.
+func (s *Scanner) Scan(filePath string, data []byte) []Finding {
+	if sync.IsBinary(data) {
+		return nil
+	}
+
+	var findings []Finding
+	for _, rule := range s.rules {
+		findings = append(findings, s.match(filePath, data, rule.Name, rule.Pattern, nil)...)
+	}
+	if isJSON(filePath) {
+		findings = append(findings, s.match(filePath, data, "high-entropy-string", jsonValue, looksRandom)...)
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Start < findings[j].Start
+	})
+
+	// Keep the first rule to report an overlapping range
+	kept := findings[:0]
+	end := -1
+	for _, f := range findings {
+		if f.Start < end {
+			continue
+		}
+		kept = append(kept, f)
+		end = f.End
+	}
+	return kept
+}
+
+// match runs a single pattern over data. keep, if set, must accept the
+// secret for it to be reported.
+func (s *Scanner) match(filePath string, data []byte, name string, re *regexp.Regexp, keep func(string) bool) []Finding {
+	group := re.SubexpIndex("secret")
+
+	var findings []Finding
+	for _, loc := range re.FindAllSubmatchIndex(data, -1) {
+		start, end := loc[0], loc[1]
+		if group > 0 {
+			start, end = loc[2*group], loc[2*group+1]
+		}
+		value := string(data[start:end])
+
+		if keep != nil && !keep(value) {
+			continue
+		}
+		if s.allowed(value) || allowedLine(data, start) {
+			continue
+		}
+
+		findings = append(findings, Finding{
+			Path:  filePath,
+			Line:  bytes.Count(data[:start], []byte("\n")) + 1,
+			Rule:  name,
+			Start: start,
+			End:   end,
+			value: value,
+		})
+	}
+	return findings
+}
+
+// allowed checks a secret against the allowlist
+func (s *Scanner) allowed(value string) bool {
+	for _, re := range s.allowlist {
+		if re.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Redact replaces every finding in data with Redacted
+func Redact(data []byte, findings []Finding) []byte {
+	sorted := append([]Finding{}, findings...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Start < sorted[j].Start
+	})
+
+	var out bytes.Buffer
+	pos := 0
+	for _, f := range sorted {
+		if f.Start < pos {
+			// Overlaps a range already redacted
+			if f.End > pos {
+				pos = f.End
+			}
+			continue
+		}
+		out.Write(data[pos:f.Start])
+		out.WriteString(Redacted)
+		pos = f.End
+	}
+	out.Write(data[pos:])
+	return out.Bytes()
+}
+
+// allowedLine checks whether the line containing offset carries AllowMarker
+func allowedLine(data []byte, offset int) bool {
+	start := bytes.LastIndexByte(data[:offset], '\n') + 1
+	end := bytes.IndexByte(data[offset:], '\n')
+	if end < 0 {
+		end = len(data)
+	} else {
+		end += offset
+	}
+	return bytes.Contains(data[start:end], []byte(AllowMarker))
+}
+
+// looksRandom reports whether a JSON string value is likely a token rather
+// than a path, URL or placeholder
+func looksRandom(value string) bool {
+	if strings.Contains(value, "://") || strings.HasPrefix(value, "/") ||
+		strings.HasPrefix(value, ".") || strings.Contains(value, "${") {
+		return false
+	}
+
+	hasLetter, hasDigit := false, false
+	for _, r := range value {
+		switch {
+		case r >= '0' && r <= '9':
+			hasDigit = true
+		case (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z'):
+			hasLetter = true
+		}
+	}
+	return hasLetter && hasDigit && entropy(value) >= minEntropy
+}
+
+// entropy returns the Shannon entropy of s in bits per character
+func entropy(s string) float64 {
+	counts := make(map[rune]int)
+	n := 0
+	for _, r := range s {
+		counts[r]++
+		n++
+	}
+
+	var h float64
+	for _, c := range counts {
+		p := float64(c) / float64(n)
+		h -= p * math.Log2(p)
+	}
+	return h
+}
+
+// isJSON checks whether a file is scanned for high-entropy values
+func isJSON(filePath string) bool {
+	ext := strings.ToLower(path.Ext(filePath))
+	for _, e := range jsonExtensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
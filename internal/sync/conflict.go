@@ -0,0 +1,218 @@
+package sync
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Strategy is a conflict resolution strategy
+type Strategy string
+
+// Supported conflict resolution strategies
+const (
+	StrategyNewest Strategy = "newest" // keep whichever side was modified last
+	StrategyLocal  Strategy = "local"  // keep the working directory version
+	StrategyRemote Strategy = "remote" // keep the workspace-config version
+	StrategyManual Strategy = "manual" // keep both and let the user decide
+)
+
+// ConflictSuffix is appended to side-by-side copies written by the manual strategy
+const ConflictSuffix = ".metarepo-conflict"
+
+// ParseStrategy parses a strategy name, defaulting to newest
+func ParseStrategy(s string) (Strategy, error) {
+	switch Strategy(s) {
+	case "":
+		return StrategyNewest, nil
+	case StrategyNewest, StrategyLocal, StrategyRemote, StrategyManual:
+		return Strategy(s), nil
+	default:
+		return "", fmt.Errorf("invalid conflict strategy %q (expected newest, local, remote or manual)", s)
+	}
+}
+
+// Pair is a working directory and its copy in workspace-config. Push copies
+// Local to Remote; pull copies Remote to Local.
+type Pair struct {
+	Local  string
+	Remote string
+	Push   bool
+}
+
+// Source returns the root files are copied from
+func (p Pair) Source() string {
+	if p.Push {
+		return p.Local
+	}
+	return p.Remote
+}
+
+// Dest returns the root files are copied to
+func (p Pair) Dest() string {
+	if p.Push {
+		return p.Remote
+	}
+	return p.Local
+}
+
+// ConflictKind describes how the two sides of a conflict differ
+type ConflictKind int
+
+const (
+	// BothModified means the destination changed since the last sync and differs from the source
+	BothModified ConflictKind = iota
+	// DeletedInSource means the source no longer has a file the destination changed
+	DeletedInSource
+)
+
+func (k ConflictKind) String() string {
+	if k == DeletedInSource {
+		return "deleted in source, modified in destination"
+	}
+	return "modified on both sides"
+}
+
+// Conflict is a file that cannot be synced without losing changes
+type Conflict struct {
+	Path       string // slash-separated, relative to the pair roots
+	Kind       ConflictKind
+	SourceTime time.Time
+	DestTime   time.Time
+}
+
+// Resolution is the outcome of resolving a conflict
+type Resolution int
+
+const (
+	TakeSource Resolution = iota // overwrite the destination
+	KeepDest                     // leave the destination untouched
+	KeepBoth                     // leave the destination and write a side-by-side copy
+)
+
+// Comparison is the result of comparing the two sides of a pair
+type Comparison struct {
+	Conflicts    []Conflict
+	SourceHashes map[string]string // hashes of all source files
+}
+
+// Compare compares files under paths on both sides of the pair, using the
+// filter and transform of opts. A file conflicts when the destination differs
+// from the (transformed) source and has changed since the last sync recorded
+// in base (or was never synced). Source files the transform skips are treated
+// as absent.
+func Compare(pair Pair, paths []string, base map[string]string, opts Options) (*Comparison, error) {
+	src, err := ListFiles(pair.Source(), paths, opts.Filter)
+	if err != nil {
+		return nil, err
+	}
+	dst, err := ListFiles(pair.Dest(), paths, opts.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	cmp := &Comparison{SourceHashes: make(map[string]string, len(src))}
+	for rel, srcInfo := range src {
+		data, err := ReadFile(pair.Source(), rel, opts.Transform)
+		if err == ErrSkipFile {
+			delete(src, rel)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		srcHash := hashBytes(data)
+		cmp.SourceHashes[rel] = srcHash
+
+		dstInfo, ok := dst[rel]
+		if !ok {
+			continue
+		}
+		dstHash, err := HashFile(filepath.Join(pair.Dest(), filepath.FromSlash(rel)))
+		if err != nil {
+			return nil, err
+		}
+		if dstHash == srcHash || dstHash == base[rel] {
+			continue
+		}
+		cmp.Conflicts = append(cmp.Conflicts, Conflict{
+			Path:       rel,
+			Kind:       BothModified,
+			SourceTime: srcInfo.ModTime(),
+			DestTime:   dstInfo.ModTime(),
+		})
+	}
+
+	for rel, dstInfo := range dst {
+		if _, ok := src[rel]; ok {
+			continue
+		}
+		dstHash, err := HashFile(filepath.Join(pair.Dest(), filepath.FromSlash(rel)))
+		if err != nil {
+			return nil, err
+		}
+		if dstHash == base[rel] {
+			continue
+		}
+		cmp.Conflicts = append(cmp.Conflicts, Conflict{
+			Path:     rel,
+			Kind:     DeletedInSource,
+			DestTime: dstInfo.ModTime(),
+		})
+	}
+
+	sortConflicts(cmp.Conflicts)
+	return cmp, nil
+}
+
+// Resolve decides how a conflict is handled for a pair
+func (s Strategy) Resolve(c Conflict, pair Pair) Resolution {
+	switch s {
+	case StrategyManual:
+		return KeepBoth
+	case StrategyLocal:
+		if pair.Push {
+			return TakeSource
+		}
+		return KeepDest
+	case StrategyRemote:
+		if pair.Push {
+			return KeepDest
+		}
+		return TakeSource
+	default:
+		// A deletion has no timestamp, so the surviving file wins
+		if c.Kind == DeletedInSource || !c.SourceTime.After(c.DestTime) {
+			return KeepDest
+		}
+		return TakeSource
+	}
+}
+
+// WriteConflictCopy writes the non-local version of a conflicting file next
+// to the local file, so both versions can be compared by hand. The content is
+// passed through transform, if set. It returns the path of the copy, or "" if
+// there is no other version to write.
+func WriteConflictCopy(c Conflict, pair Pair, transform TransformFunc) (string, error) {
+	// On pull, a file deleted remotely only exists locally
+	if c.Kind == DeletedInSource && !pair.Push {
+		return "", nil
+	}
+
+	srcPath := filepath.Join(pair.Remote, filepath.FromSlash(c.Path))
+	copyPath := filepath.Join(pair.Local, filepath.FromSlash(c.Path)) + ConflictSuffix
+
+	info, err := os.Stat(srcPath)
+	if err != nil {
+		return "", err
+	}
+	data, err := ReadFile(pair.Remote, c.Path, transform)
+	if err != nil {
+		return "", err
+	}
+	if err := writeFileAtomic(copyPath, data, info); err != nil {
+		return "", err
+	}
+	return copyPath, nil
+}
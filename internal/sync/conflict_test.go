@@ -0,0 +1,262 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompare(t *testing.T) {
+	base := map[string]string{
+		"a.json": hashBytes([]byte("base")),
+		"b.json": hashBytes([]byte("base")),
+	}
+
+	tests := []struct {
+		name string
+		src  map[string]string
+		dst  map[string]string
+		base map[string]string
+		opts Options
+		want string // conflicts as path:kind
+	}{
+		{
+			name: "destination unchanged since base",
+			src:  map[string]string{"a.json": "new"},
+			dst:  map[string]string{"a.json": "base"},
+			base: base,
+		},
+		{
+			name: "same content on both sides",
+			src:  map[string]string{"a.json": "same"},
+			dst:  map[string]string{"a.json": "same"},
+			base: base,
+		},
+		{
+			name: "added in source only",
+			src:  map[string]string{"c.json": "c"},
+			base: base,
+		},
+		{
+			name: "modified on both sides",
+			src:  map[string]string{"a.json": "src"},
+			dst:  map[string]string{"a.json": "dst"},
+			base: base,
+			want: "a.json:modified on both sides",
+		},
+		{
+			name: "never synced and different",
+			src:  map[string]string{"c.json": "src"},
+			dst:  map[string]string{"c.json": "dst"},
+			base: base,
+			want: "c.json:modified on both sides",
+		},
+		{
+			name: "deleted in source, unchanged in destination",
+			dst:  map[string]string{"a.json": "base"},
+			base: base,
+		},
+		{
+			name: "deleted in source, modified in destination",
+			dst:  map[string]string{"a.json": "dst"},
+			base: base,
+			want: "a.json:deleted in source, modified in destination",
+		},
+		{
+			name: "compared after transform",
+			src:  map[string]string{"a.json": "dst"},
+			dst:  map[string]string{"a.json": "DST"},
+			base: base,
+			opts: Options{Transform: func(rel string, data []byte) ([]byte, error) {
+				return []byte(strings.ToUpper(string(data))), nil
+			}},
+		},
+		{
+			name: "skipped source file counts as deleted",
+			src:  map[string]string{"a.json": "src"},
+			dst:  map[string]string{"a.json": "dst"},
+			base: base,
+			opts: Options{Transform: func(string, []byte) ([]byte, error) {
+				return nil, ErrSkipFile
+			}},
+			want: "a.json:deleted in source, modified in destination",
+		},
+		{
+			name: "several, sorted",
+			src:  map[string]string{"b.json": "src", "a.json": "src"},
+			dst:  map[string]string{"b.json": "dst", "a.json": "dst"},
+			base: base,
+			want: "a.json:modified on both sides,b.json:modified on both sides",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pair := Pair{Local: t.TempDir(), Remote: t.TempDir(), Push: true}
+			writeFiles(t, pair.Source(), tt.src)
+			writeFiles(t, pair.Dest(), tt.dst)
+
+			cmp, err := Compare(pair, []string{"."}, tt.base, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, c := range cmp.Conflicts {
+				got = append(got, c.Path+":"+c.Kind.String())
+			}
+			if strings.Join(got, ",") != tt.want {
+				t.Errorf("conflicts = %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	older := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(time.Hour)
+	srcNewer := Conflict{Kind: BothModified, SourceTime: newer, DestTime: older}
+	dstNewer := Conflict{Kind: BothModified, SourceTime: older, DestTime: newer}
+	deleted := Conflict{Kind: DeletedInSource, DestTime: older}
+	push, pull := Pair{Push: true}, Pair{}
+
+	tests := []struct {
+		strategy Strategy
+		conflict Conflict
+		pair     Pair
+		want     Resolution
+	}{
+		{StrategyNewest, srcNewer, push, TakeSource},
+		{StrategyNewest, dstNewer, push, KeepDest},
+		{StrategyNewest, srcNewer, pull, TakeSource},
+		{StrategyNewest, deleted, pull, KeepDest},
+		{StrategyLocal, srcNewer, push, TakeSource},
+		{StrategyLocal, srcNewer, pull, KeepDest},
+		{StrategyLocal, deleted, push, TakeSource},
+		{StrategyRemote, srcNewer, push, KeepDest},
+		{StrategyRemote, dstNewer, pull, TakeSource},
+		{StrategyRemote, deleted, pull, TakeSource},
+		{StrategyManual, srcNewer, push, KeepBoth},
+		{StrategyManual, deleted, pull, KeepBoth},
+	}
+	for _, tt := range tests {
+		if got := tt.strategy.Resolve(tt.conflict, tt.pair); got != tt.want {
+			t.Errorf("%s.Resolve(%s, push=%v) = %v, want %v", tt.strategy, tt.conflict.Kind, tt.pair.Push, got, tt.want)
+		}
+	}
+}
+
+func TestParseStrategy(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Strategy
+		ok   bool
+	}{
+		{"", StrategyNewest, true},
+		{"newest", StrategyNewest, true},
+		{"local", StrategyLocal, true},
+		{"remote", StrategyRemote, true},
+		{"manual", StrategyManual, true},
+		{"theirs", "", false},
+	}
+	for _, tt := range tests {
+		got, err := ParseStrategy(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("ParseStrategy(%q) = %q, %v", tt.in, got, err)
+		}
+	}
+}
+
+// TestSyncStrategies runs a pull the way the CLI does: compare, resolve,
+// mirror the rest and record the new base
+func TestSyncStrategies(t *testing.T) {
+	tests := []struct {
+		strategy Strategy
+		local    string // content of conflict.json after the pull
+		deleted  bool   // whether deleted.json is gone after the pull
+		copies   bool   // whether conflict copies are written
+	}{
+		{StrategyNewest, "remote", false, false},
+		{StrategyLocal, "local", false, false},
+		{StrategyRemote, "remote", true, false},
+		{StrategyManual, "local", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.strategy), func(t *testing.T) {
+			pair := Pair{Local: t.TempDir(), Remote: t.TempDir()}
+			synced := map[string]string{"conflict.json": "base", "deleted.json": "base", "updated.json": "base"}
+			writeFiles(t, pair.Local, synced)
+			writeFiles(t, pair.Remote, synced)
+
+			state := &State{Pairs: map[string]map[string]string{}}
+			cmp, err := Compare(pair, []string{"."}, nil, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			state.Record("pull/laptop", []string{"."}, cmp.SourceHashes, nil)
+
+			// Both sides change: the remote later than the local side
+			writeFiles(t, pair.Local, map[string]string{"conflict.json": "local", "deleted.json": "local", "added.json": "local"})
+			writeFiles(t, pair.Remote, map[string]string{"conflict.json": "remote", "updated.json": "remote", "new.json": "remote"})
+			if err := os.Remove(filepath.Join(pair.Remote, "deleted.json")); err != nil {
+				t.Fatal(err)
+			}
+			later := time.Now().Add(time.Hour)
+			if err := os.Chtimes(filepath.Join(pair.Remote, "conflict.json"), later, later); err != nil {
+				t.Fatal(err)
+			}
+
+			cmp, err = Compare(pair, []string{"."}, state.Base("pull/laptop"), Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(cmp.Conflicts) != 3 {
+				t.Fatalf("conflicts = %v, want conflict.json, deleted.json and added.json", cmp.Conflicts)
+			}
+
+			kept := map[string]bool{}
+			for _, c := range cmp.Conflicts {
+				switch tt.strategy.Resolve(c, pair) {
+				case KeepDest:
+					kept[c.Path] = true
+				case KeepBoth:
+					kept[c.Path] = true
+					if _, err := WriteConflictCopy(c, pair, nil); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			// Conflict copies are excluded by default, so the mirror keeps them
+			opts := Options{Filter: Filter{Exclude: DefaultExcludes}, Skip: kept}
+			if _, err := Mirror(pair.Remote, pair.Local, []string{"."}, opts); err != nil {
+				t.Fatal(err)
+			}
+			state.Record("pull/laptop", []string{"."}, cmp.SourceHashes, kept)
+
+			got := readFiles(t, pair.Local)
+			if got["conflict.json"] != tt.local {
+				t.Errorf("conflict.json = %q, want %q", got["conflict.json"], tt.local)
+			}
+			if _, ok := got["deleted.json"]; ok == tt.deleted {
+				t.Errorf("deleted.json present = %v, want %v", ok, !tt.deleted)
+			}
+			if got["updated.json"] != "remote" || got["new.json"] != "remote" {
+				t.Errorf("non-conflicting changes not pulled: %v", got)
+			}
+			if _, ok := got["conflict.json"+ConflictSuffix]; ok != tt.copies {
+				t.Errorf("conflict copy present = %v, want %v", ok, tt.copies)
+			}
+
+			// Kept files conflict again on the next pull; the rest is settled
+			cmp, err = Compare(pair, []string{"."}, state.Base("pull/laptop"), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, c := range cmp.Conflicts {
+				if !kept[c.Path] {
+					t.Errorf("%s conflicts again after it was synced", c.Path)
+				}
+			}
+		})
+	}
+}
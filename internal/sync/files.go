@@ -0,0 +1,137 @@
+package sync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultExcludes are never synced. Patterns ending in "/" match directories.
+var DefaultExcludes = []string{
+	".git/",
+	"node_modules/",
+	".venv/",
+	"venv/",
+	"__pycache__/",
+	".DS_Store",
+	"*" + ConflictSuffix,
+}
+
+// Filter selects the files a sync operates on
+type Filter struct {
+	Include []string // if set, only files matching one of these are selected
+	Exclude []string // files and directories matching these are skipped
+}
+
+// ListFiles returns the regular files under each of paths (relative to root)
+// selected by filter, keyed by slash-separated path relative to root.
+// Missing paths are ignored.
+func ListFiles(root string, paths []string, filter Filter) (map[string]fs.FileInfo, error) {
+	files := make(map[string]fs.FileInfo)
+
+	for _, p := range paths {
+		start := filepath.Join(root, filepath.FromSlash(strings.TrimSuffix(p, "/")))
+		if _, err := os.Lstat(start); os.IsNotExist(err) {
+			continue
+		}
+
+		err := filepath.WalkDir(start, func(current string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			rel, err := filepath.Rel(root, current)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+
+			if MatchAny(rel, d.IsDir(), filter.Exclude) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			if !d.Type().IsRegular() {
+				return nil
+			}
+
+			if len(filter.Include) > 0 && !MatchAny(rel, false, filter.Include) {
+				return nil
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			files[rel] = info
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
+
+// MatchAny checks a slash-separated relative path against patterns.
+// Patterns without a "/" (other than a trailing one) match the last path
+// element; other patterns are matched against the whole path relative to the
+// workspace root. Patterns ending in "/" only match directories.
+func MatchAny(rel string, isDir bool, patterns []string) bool {
+	name := path.Base(rel)
+	for _, pattern := range patterns {
+		dirOnly := strings.HasSuffix(pattern, "/")
+		pattern = strings.TrimSuffix(pattern, "/")
+		if dirOnly && !isDir {
+			continue
+		}
+
+		if strings.Contains(pattern, "/") {
+			if matched, _ := path.Match(strings.TrimPrefix(pattern, "/"), rel); matched {
+				return true
+			}
+			continue
+		}
+
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// HashFile returns the hex-encoded SHA-256 of a file's contents
+func HashFile(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashBytes returns the hex-encoded SHA-256 of data
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func sortConflicts(conflicts []Conflict) {
+	sort.Slice(conflicts, func(i, j int) bool {
+		return conflicts[i].Path < conflicts[j].Path
+	})
+}
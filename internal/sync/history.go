@@ -0,0 +1,315 @@
+package sync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JPlanken/metarepo-cli/internal/fsutil"
+	"gopkg.in/yaml.v3"
+)
+
+// Snapshot records the files of a device's workspace-config after a sync
+type Snapshot struct {
+	ID      string            `yaml:"id"`
+	Device  string            `yaml:"device"`
+	Created time.Time         `yaml:"created"`
+	Files   map[string]string `yaml:"files"`           // slash-separated path -> content hash
+	Modes   map[string]string `yaml:"modes,omitempty"` // slash-separated path -> octal mode, if not 0644
+}
+
+// defaultMode is the mode of snapshot files not listed in Modes
+const defaultMode fs.FileMode = 0644
+
+// Mode returns the permission bits of the file at rel
+func (snap *Snapshot) Mode(rel string) fs.FileMode {
+	if m, err := strconv.ParseUint(snap.Modes[rel], 8, 32); err == nil {
+		return fs.FileMode(m).Perm()
+	}
+	return defaultMode
+}
+
+// History stores snapshots with their file contents addressed by hash, so
+// files unchanged between snapshots are stored once.
+//
+// Layout:
+//
+//	objects/<hash[:2]>/<hash>
+//	snapshots/<device>/<time>-<id>.yaml
+type History struct {
+	Dir string
+}
+
+// NewHistory returns the history stored in dir
+func NewHistory(dir string) *History {
+	return &History{Dir: dir}
+}
+
+// Record takes a snapshot of every file under root for device. If nothing
+// changed since the device's last snapshot, no snapshot is written and nil is
+// returned.
+func (h *History) Record(device, root string, now time.Time) (*Snapshot, error) {
+	files, err := ListFiles(root, []string{"."}, Filter{})
+	if err != nil {
+		return nil, err
+	}
+
+	snap := &Snapshot{Device: device, Created: now.UTC(), Files: make(map[string]string, len(files))}
+	for rel, info := range files {
+		path := filepath.Join(root, filepath.FromSlash(rel))
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		hash := hashBytes(data)
+		if err := h.writeObject(hash, data); err != nil {
+			return nil, err
+		}
+		snap.Files[rel] = hash
+		if mode := info.Mode().Perm(); mode != defaultMode {
+			if snap.Modes == nil {
+				snap.Modes = map[string]string{}
+			}
+			snap.Modes[rel] = fmt.Sprintf("%04o", mode)
+		}
+	}
+
+	previous, err := h.List(device)
+	if err != nil {
+		return nil, err
+	}
+	if len(previous) > 0 && sameFiles(previous[0], snap) {
+		return nil, nil
+	}
+	if len(previous) == 0 && len(snap.Files) == 0 {
+		return nil, nil
+	}
+
+	snap.ID = snapshotID(snap)
+	data, err := yaml.Marshal(snap)
+	if err != nil {
+		return nil, err
+	}
+	path := h.snapshotPath(snap)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	if err := fsutil.WriteFile(path, data, 0644); err != nil {
+		return nil, err
+	}
+
+	return snap, nil
+}
+
+// List returns the snapshots of device, or of all devices if device is
+// empty, newest first
+func (h *History) List(device string) ([]*Snapshot, error) {
+	root := filepath.Join(h.Dir, "snapshots")
+	if device != "" {
+		root = filepath.Join(root, device)
+	}
+
+	var snaps []*Snapshot
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".yaml") {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var snap Snapshot
+		if err := yaml.Unmarshal(data, &snap); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		snaps = append(snaps, &snap)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(snaps, func(i, j int) bool {
+		return snaps[i].Created.After(snaps[j].Created)
+	})
+	return snaps, nil
+}
+
+// Find returns the snapshot whose ID starts with id
+func (h *History) Find(id string) (*Snapshot, error) {
+	snaps, err := h.List("")
+	if err != nil {
+		return nil, err
+	}
+
+	var found *Snapshot
+	for _, snap := range snaps {
+		if !strings.HasPrefix(snap.ID, id) {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("snapshot ID %q is ambiguous", id)
+		}
+		found = snap
+	}
+	if found == nil {
+		return nil, fmt.Errorf("snapshot not found: %s", id)
+	}
+	return found, nil
+}
+
+// Previous returns the snapshot of the same device taken before snap, or nil
+func (h *History) Previous(snap *Snapshot) (*Snapshot, error) {
+	snaps, err := h.List(snap.Device)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range snaps {
+		if s.Created.Before(snap.Created) {
+			return s, nil
+		}
+	}
+	return nil, nil
+}
+
+// RenameDevice moves the snapshots of device oldName to newName
+func (h *History) RenameDevice(oldName, newName string) error {
+	oldDir := filepath.Join(h.Dir, "snapshots", oldName)
+	newDir := filepath.Join(h.Dir, "snapshots", newName)
+	if _, err := os.Stat(newDir); err == nil {
+		return fmt.Errorf("%s already exists", newDir)
+	}
+	if err := os.Rename(oldDir, newDir); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	snaps, err := h.List(newName)
+	if err != nil {
+		return err
+	}
+	for _, snap := range snaps {
+		snap.Device = newName
+		data, err := yaml.Marshal(snap)
+		if err != nil {
+			return err
+		}
+		if err := fsutil.WriteFile(h.snapshotPath(snap), data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Materialize writes the files of snap under dir
+func (h *History) Materialize(snap *Snapshot, dir string) error {
+	for rel, hash := range snap.Files {
+		data, err := os.ReadFile(h.objectPath(hash))
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", rel, err)
+		}
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := fsutil.WriteFile(path, data, snap.Mode(rel)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Changes returns the files added, updated and deleted in snap compared to
+// previous, which may be nil
+func (snap *Snapshot) Changes(previous *Snapshot) *ChangeSet {
+	old := map[string]string{}
+	if previous != nil {
+		old = previous.Files
+	}
+
+	changes := &ChangeSet{}
+	for rel, hash := range snap.Files {
+		if oldHash, ok := old[rel]; !ok {
+			changes.Added = append(changes.Added, rel)
+		} else if oldHash != hash || snap.Mode(rel) != previous.Mode(rel) {
+			changes.Updated = append(changes.Updated, rel)
+		}
+	}
+	for rel := range old {
+		if _, ok := snap.Files[rel]; !ok {
+			changes.Deleted = append(changes.Deleted, rel)
+		}
+	}
+	sort.Strings(changes.Added)
+	sort.Strings(changes.Updated)
+	sort.Strings(changes.Deleted)
+	return changes
+}
+
+func (h *History) snapshotPath(snap *Snapshot) string {
+	return filepath.Join(h.Dir, "snapshots", snap.Device, snap.Created.Format("20060102T150405Z")+"-"+snap.ID+".yaml")
+}
+
+func (h *History) objectPath(hash string) string {
+	return filepath.Join(h.Dir, "objects", hash[:2], hash)
+}
+
+// writeObject stores data under its hash unless it is already stored
+func (h *History) writeObject(hash string, data []byte) error {
+	path := h.objectPath(hash)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return fsutil.WriteFile(path, data, 0644)
+}
+
+// snapshotID derives a short ID from the snapshot's device, time and files
+func snapshotID(snap *Snapshot) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n", snap.Device, snap.Created.Format(time.RFC3339Nano))
+	keys := make([]string, 0, len(snap.Files))
+	for rel := range snap.Files {
+		keys = append(keys, rel)
+	}
+	sort.Strings(keys)
+	for _, rel := range keys {
+		fmt.Fprintf(h, "%s %s\n", snap.Files[rel], rel)
+		if mode, ok := snap.Modes[rel]; ok {
+			fmt.Fprintf(h, "mode %s %s\n", mode, rel)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))[:10]
+}
+
+// sameFiles reports whether two snapshots hold the same files with the same
+// modes
+func sameFiles(a, b *Snapshot) bool {
+	if len(a.Files) != len(b.Files) {
+		return false
+	}
+	for rel, hash := range a.Files {
+		if b.Files[rel] != hash || a.Mode(rel) != b.Mode(rel) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,89 @@
+package sync
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestHistoryKeepsFileModes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not kept on Windows")
+	}
+
+	root := t.TempDir()
+	files := []struct {
+		rel  string
+		mode fs.FileMode
+	}{
+		{".claude/settings.json", 0644},
+		{".claude/hooks/format.sh", 0755},
+		{".claude/secret.json", 0600},
+	}
+	for _, f := range files {
+		path := filepath.Join(root, filepath.FromSlash(f.rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(f.rel), f.mode); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(path, f.mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	history := NewHistory(t.TempDir())
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	snap, err := history.Record("laptop", root, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Snapshots are read back from disk, as restore does
+	found, err := history.Find(snap.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := t.TempDir()
+	if err := history.Materialize(found, out); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		info, err := os.Stat(filepath.Join(out, filepath.FromSlash(f.rel)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.Mode().Perm(); got != f.mode {
+			t.Errorf("%s: mode %v, want %v", f.rel, got, f.mode)
+		}
+	}
+
+	// A mode change alone is a new snapshot, with the file updated
+	if err := os.Chmod(filepath.Join(root, ".claude", "settings.json"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	next, err := history.Record("laptop", root, start.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next == nil {
+		t.Fatal("no snapshot recorded for a mode change")
+	}
+	changes := next.Changes(found)
+	if len(changes.Updated) != 1 || changes.Updated[0] != ".claude/settings.json" {
+		t.Errorf("updated = %v, want [.claude/settings.json]", changes.Updated)
+	}
+
+	// Nothing changed: no snapshot
+	again, err := history.Record("laptop", root, start.Add(2*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != nil {
+		t.Errorf("recorded snapshot %s without changes", again.ID)
+	}
+}
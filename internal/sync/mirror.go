@@ -0,0 +1,201 @@
+package sync
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ErrSkipFile is returned by a TransformFunc to leave a source file out of
+// the sync, as if it didn't exist
+var ErrSkipFile = errors.New("skip file")
+
+// TransformFunc rewrites the content of a source file before it is compared
+// with and written to the destination. rel is the slash-separated path
+// relative to the roots.
+type TransformFunc func(rel string, data []byte) ([]byte, error)
+
+// Options configures a mirror operation
+type Options struct {
+	Filter    Filter          // files outside the filter are never copied or deleted
+	Skip      map[string]bool // slash-separated paths left untouched in the destination
+	Transform TransformFunc   // optional rewrite of source content
+	DryRun    bool            // report changes without writing anything
+}
+
+// ChangeSet lists the files a mirror operation added, updated and deleted,
+// as slash-separated paths relative to the roots
+type ChangeSet struct {
+	Added   []string
+	Updated []string
+	Deleted []string
+}
+
+// IsEmpty reports whether the change set has no changes
+func (c *ChangeSet) IsEmpty() bool {
+	return len(c.Added) == 0 && len(c.Updated) == 0 && len(c.Deleted) == 0
+}
+
+// Len returns the total number of changes
+func (c *ChangeSet) Len() int {
+	return len(c.Added) + len(c.Updated) + len(c.Deleted)
+}
+
+// Mirror makes each of paths under dst identical to the same path under src.
+// New and changed files are copied with their mode and modification time,
+// files missing from src are deleted, and unchanged files are left alone.
+// Paths that don't exist in src are skipped, so a missing directory never
+// wipes the destination.
+func Mirror(src, dst string, paths []string, opts Options) (*ChangeSet, error) {
+	changes := &ChangeSet{}
+
+	for _, p := range paths {
+		if _, err := os.Lstat(filepath.Join(src, filepath.FromSlash(p))); os.IsNotExist(err) {
+			continue
+		}
+
+		srcFiles, err := ListFiles(src, []string{p}, opts.Filter)
+		if err != nil {
+			return nil, err
+		}
+		dstFiles, err := ListFiles(dst, []string{p}, opts.Filter)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, rel := range sortedKeys(srcFiles) {
+			if opts.Skip[rel] {
+				continue
+			}
+			srcInfo := srcFiles[rel]
+			data, err := ReadFile(src, rel, opts.Transform)
+			if err == ErrSkipFile {
+				delete(srcFiles, rel)
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			dstPath := filepath.Join(dst, filepath.FromSlash(rel))
+
+			dstInfo, exists := dstFiles[rel]
+			if exists {
+				same, err := sameContent(data, srcInfo, dstPath, dstInfo)
+				if err != nil {
+					return nil, err
+				}
+				if same {
+					continue
+				}
+				changes.Updated = append(changes.Updated, rel)
+			} else {
+				changes.Added = append(changes.Added, rel)
+			}
+
+			if !opts.DryRun {
+				if err := writeFileAtomic(dstPath, data, srcInfo); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		for _, rel := range sortedKeys(dstFiles) {
+			if _, ok := srcFiles[rel]; ok || opts.Skip[rel] {
+				continue
+			}
+			changes.Deleted = append(changes.Deleted, rel)
+			if !opts.DryRun {
+				dstPath := filepath.Join(dst, filepath.FromSlash(rel))
+				if err := os.Remove(dstPath); err != nil {
+					return nil, err
+				}
+				removeEmptyParents(filepath.Dir(dstPath), dst)
+			}
+		}
+	}
+
+	return changes, nil
+}
+
+// ReadFile reads a file under root and applies transform, if set
+func ReadFile(root, rel string, transform TransformFunc) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(rel)))
+	if err != nil {
+		return nil, err
+	}
+	if transform == nil {
+		return data, nil
+	}
+	return transform(rel, data)
+}
+
+// sameContent checks whether the destination file already has data and the
+// source file's mode
+func sameContent(data []byte, srcInfo fs.FileInfo, dstPath string, dstInfo fs.FileInfo) (bool, error) {
+	if int64(len(data)) != dstInfo.Size() || srcInfo.Mode().Perm() != dstInfo.Mode().Perm() {
+		return false, nil
+	}
+
+	existing, err := os.ReadFile(dstPath)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(data, existing), nil
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it
+// into place, applying the mode and modification time of info
+func writeFileAtomic(path string, data []byte, info fs.FileInfo) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	if _, err := bytes.NewReader(data).WriteTo(tmp); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Chmod(tmpPath, info.Mode().Perm()); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Chtimes(tmpPath, info.ModTime(), info.ModTime()); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+// removeEmptyParents removes empty directories from dir up to (not including) root
+func removeEmptyParents(dir, root string) {
+	root = filepath.Clean(root)
+	for dir = filepath.Clean(dir); dir != root && len(dir) > len(root); dir = filepath.Dir(dir) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+	}
+}
+
+func sortedKeys(files map[string]fs.FileInfo) []string {
+	keys := make([]string, 0, len(files))
+	for k := range files {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,230 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFiles creates files under root from slash-separated paths
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for rel, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readFiles returns the content of every file under root
+func readFiles(t *testing.T, root string) map[string]string {
+	t.Helper()
+	files := map[string]string{}
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		files[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func joined(paths []string) string {
+	sorted := append([]string{}, paths...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
+
+func TestMirror(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     map[string]string
+		dst     map[string]string
+		paths   []string
+		opts    Options
+		want    map[string]string
+		added   string
+		updated string
+		deleted string
+	}{
+		{
+			name:  "add",
+			src:   map[string]string{".claude/a.json": "a"},
+			paths: []string{".claude/"},
+			want:  map[string]string{".claude/a.json": "a"},
+			added: ".claude/a.json",
+		},
+		{
+			name:    "update",
+			src:     map[string]string{".claude/a.json": "new"},
+			dst:     map[string]string{".claude/a.json": "old"},
+			paths:   []string{".claude/"},
+			want:    map[string]string{".claude/a.json": "new"},
+			updated: ".claude/a.json",
+		},
+		{
+			name:    "delete",
+			src:     map[string]string{".claude/a.json": "a"},
+			dst:     map[string]string{".claude/a.json": "a", ".claude/sub/b.json": "b"},
+			paths:   []string{".claude/"},
+			want:    map[string]string{".claude/a.json": "a"},
+			deleted: ".claude/sub/b.json",
+		},
+		{
+			name:  "unchanged",
+			src:   map[string]string{".claude/a.json": "a"},
+			dst:   map[string]string{".claude/a.json": "a"},
+			paths: []string{".claude/"},
+			want:  map[string]string{".claude/a.json": "a"},
+		},
+		{
+			name:  "missing source path keeps destination",
+			dst:   map[string]string{".cursor/a.json": "a"},
+			paths: []string{".cursor/"},
+			want:  map[string]string{".cursor/a.json": "a"},
+		},
+		{
+			name:  "other paths untouched",
+			src:   map[string]string{".claude/a.json": "a"},
+			dst:   map[string]string{".vscode/b.json": "b"},
+			paths: []string{".claude/"},
+			want:  map[string]string{".claude/a.json": "a", ".vscode/b.json": "b"},
+			added: ".claude/a.json",
+		},
+		{
+			name:  "excluded files neither copied nor deleted",
+			src:   map[string]string{".claude/a.json": "a", ".claude/a.log": "new"},
+			dst:   map[string]string{".claude/b.log": "b"},
+			paths: []string{".claude/"},
+			opts:  Options{Filter: Filter{Exclude: []string{"*.log"}}},
+			want:  map[string]string{".claude/a.json": "a", ".claude/b.log": "b"},
+			added: ".claude/a.json",
+		},
+		{
+			name:  "skipped files left alone",
+			src:   map[string]string{".claude/a.json": "new"},
+			dst:   map[string]string{".claude/a.json": "old", ".claude/b.json": "b"},
+			paths: []string{".claude/"},
+			opts:  Options{Skip: map[string]bool{".claude/a.json": true, ".claude/b.json": true}},
+			want:  map[string]string{".claude/a.json": "old", ".claude/b.json": "b"},
+		},
+		{
+			name:  "transform",
+			src:   map[string]string{".claude/a.json": "a", ".claude/secret.json": "s"},
+			dst:   map[string]string{".claude/secret.json": "old"},
+			paths: []string{".claude/"},
+			opts: Options{Transform: func(rel string, data []byte) ([]byte, error) {
+				if strings.HasSuffix(rel, "secret.json") {
+					return nil, ErrSkipFile
+				}
+				return []byte(strings.ToUpper(string(data))), nil
+			}},
+			want:    map[string]string{".claude/a.json": "A"},
+			added:   ".claude/a.json",
+			deleted: ".claude/secret.json",
+		},
+		{
+			name:    "dry run",
+			src:     map[string]string{".claude/a.json": "new", ".claude/c.json": "c"},
+			dst:     map[string]string{".claude/a.json": "old", ".claude/b.json": "b"},
+			paths:   []string{".claude/"},
+			opts:    Options{DryRun: true},
+			want:    map[string]string{".claude/a.json": "old", ".claude/b.json": "b"},
+			added:   ".claude/c.json",
+			updated: ".claude/a.json",
+			deleted: ".claude/b.json",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, dst := t.TempDir(), t.TempDir()
+			writeFiles(t, src, tt.src)
+			writeFiles(t, dst, tt.dst)
+
+			changes, err := Mirror(src, dst, tt.paths, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := joined(changes.Added); got != tt.added {
+				t.Errorf("added = %s, want %s", got, tt.added)
+			}
+			if got := joined(changes.Updated); got != tt.updated {
+				t.Errorf("updated = %s, want %s", got, tt.updated)
+			}
+			if got := joined(changes.Deleted); got != tt.deleted {
+				t.Errorf("deleted = %s, want %s", got, tt.deleted)
+			}
+
+			got := readFiles(t, dst)
+			if len(got) != len(tt.want) {
+				t.Errorf("destination = %v, want %v", got, tt.want)
+			}
+			for rel, content := range tt.want {
+				if got[rel] != content {
+					t.Errorf("%s = %q, want %q", rel, got[rel], content)
+				}
+			}
+		})
+	}
+}
+
+func TestMirrorRemovesEmptyDirectories(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeFiles(t, src, map[string]string{".claude/a.json": "a"})
+	writeFiles(t, dst, map[string]string{".claude/a.json": "a", ".claude/x/y/b.json": "b"})
+
+	if _, err := Mirror(src, dst, []string{".claude/"}, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, ".claude", "x")); !os.IsNotExist(err) {
+		t.Errorf("empty directory left behind: %v", err)
+	}
+}
+
+func TestMirrorCopiesModeAndTime(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not kept on Windows")
+	}
+
+	src, dst := t.TempDir(), t.TempDir()
+	writeFiles(t, src, map[string]string{".claude/hook.sh": "#!/bin/sh"})
+	path := filepath.Join(src, ".claude", "hook.sh")
+	if err := os.Chmod(path, 0755); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Mirror(src, dst, []string{".claude/"}, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filepath.Join(dst, ".claude", "hook.sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0755 {
+		t.Errorf("mode = %v, want 0755", info.Mode().Perm())
+	}
+	if !info.ModTime().Equal(modTime) {
+		t.Errorf("modification time = %v, want %v", info.ModTime(), modTime)
+	}
+}
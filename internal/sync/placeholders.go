@@ -0,0 +1,169 @@
+package sync
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Placeholders written in place of device-specific absolute paths
+const (
+	WorkspaceRootVar = "${WORKSPACE_ROOT}"
+	HomeVar          = "${HOME}"
+)
+
+// escapedExtensions are files where backslashes in paths appear escaped
+var escapedExtensions = []string{".json", ".jsonc", ".code-workspace"}
+
+// Placeholders holds the values of the path placeholders on this device
+type Placeholders struct {
+	WorkspaceRoot string
+	Home          string
+}
+
+// CurrentPlaceholders returns the placeholder values for a workspace root on
+// this device
+func CurrentPlaceholders(workspaceRoot string) (Placeholders, error) {
+	root, err := filepath.Abs(workspaceRoot)
+	if err != nil {
+		return Placeholders{}, err
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return Placeholders{}, err
+	}
+	return Placeholders{WorkspaceRoot: root, Home: filepath.Clean(home)}, nil
+}
+
+// Collapse replaces the workspace root and home directory in text files with
+// placeholders. The workspace root is replaced first, as it usually lies in
+// the home directory. Placeholders already in the file are escaped with an
+// extra $, so ${HOME} is written as $${HOME} and Expand restores it as is.
+// Binary files are returned unchanged.
+func (p Placeholders) Collapse(rel string, data []byte) ([]byte, error) {
+	if IsBinary(data) {
+		return data, nil
+	}
+	for _, name := range []string{WorkspaceRootVar, HomeVar} {
+		data = bytes.ReplaceAll(data, []byte(name), []byte("$"+name))
+	}
+	for _, v := range []struct{ value, name string }{
+		{p.WorkspaceRoot, WorkspaceRootVar},
+		{p.Home, HomeVar},
+	} {
+		for _, form := range pathForms(v.value, rel) {
+			data = replacePath(data, form, v.name)
+		}
+	}
+	return data, nil
+}
+
+// Expand replaces placeholders in text files with this device's values and
+// removes one $ from escaped placeholders, undoing Collapse. Binary files are
+// returned unchanged.
+func (p Placeholders) Expand(rel string, data []byte) ([]byte, error) {
+	if IsBinary(data) || !bytes.Contains(data, []byte("${")) {
+		return data, nil
+	}
+	root, home := p.WorkspaceRoot, p.Home
+	if escaped(rel) {
+		root = strings.ReplaceAll(root, `\`, `\\`)
+		home = strings.ReplaceAll(home, `\`, `\\`)
+	}
+	data = expandVar(data, WorkspaceRootVar, root)
+	data = expandVar(data, HomeVar, home)
+	return data, nil
+}
+
+// expandVar replaces name with value, except where name follows a $, which
+// marks it as escaped; there the $ is dropped instead
+func expandVar(data []byte, name, value string) []byte {
+	needle := []byte(name)
+	var out bytes.Buffer
+	for {
+		i := bytes.Index(data, needle)
+		if i < 0 {
+			out.Write(data)
+			return out.Bytes()
+		}
+		if i > 0 && data[i-1] == '$' {
+			out.Write(data[:i-1])
+			out.Write(needle)
+		} else {
+			out.Write(data[:i])
+			out.WriteString(value)
+		}
+		data = data[i+len(needle):]
+	}
+}
+
+// pathForms returns the spellings of an absolute path to look for in rel:
+// the path itself, its symlink-resolved form and, in files that escape
+// backslashes, the escaped form
+func pathForms(value, rel string) []string {
+	if value == "" || value == string(filepath.Separator) {
+		return nil
+	}
+
+	forms := []string{value}
+	if resolved, err := filepath.EvalSymlinks(value); err == nil && resolved != value {
+		forms = append(forms, resolved)
+	}
+	if escaped(rel) && strings.Contains(value, `\`) {
+		for _, f := range forms {
+			forms = append(forms, strings.ReplaceAll(f, `\`, `\\`))
+		}
+	}
+	return forms
+}
+
+// replacePath replaces value with name wherever it appears as a whole path,
+// that is, not followed by more characters of the same path element. A path
+// right after a $ is left alone, as the placeholder would read as escaped.
+func replacePath(data []byte, value, name string) []byte {
+	needle := []byte(value)
+	var out bytes.Buffer
+	for {
+		i := bytes.Index(data, needle)
+		if i < 0 {
+			out.Write(data)
+			return out.Bytes()
+		}
+		end := i + len(needle)
+		out.Write(data[:i])
+		afterDollar := out.Len() > 0 && out.Bytes()[out.Len()-1] == '$'
+		if afterDollar || (end < len(data) && isPathChar(data[end])) {
+			out.Write(needle)
+		} else {
+			out.WriteString(name)
+		}
+		data = data[end:]
+	}
+}
+
+// isPathChar reports whether c can continue a file name
+func isPathChar(c byte) bool {
+	return c == '.' || c == '-' || c == '_' ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func escaped(rel string) bool {
+	ext := strings.ToLower(path.Ext(rel))
+	for _, e := range escapedExtensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// IsBinary reports whether data looks like a binary file, i.e. has a NUL
+// byte in its first 8000 bytes
+func IsBinary(data []byte) bool {
+	if len(data) > 8000 {
+		data = data[:8000]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
@@ -0,0 +1,62 @@
+package sync
+
+import "testing"
+
+func TestPlaceholdersRoundTrip(t *testing.T) {
+	p := Placeholders{WorkspaceRoot: "/home/ann/work", Home: "/home/ann"}
+
+	tests := []struct {
+		name      string
+		rel       string
+		local     string
+		collapsed string
+	}{
+		{"workspace root", "a.txt", "cd /home/ann/work/x", "cd ${WORKSPACE_ROOT}/x"},
+		{"home", "a.txt", "ls /home/ann/.config", "ls ${HOME}/.config"},
+		{"longer path element", "a.txt", "/home/anna", "/home/anna"},
+		{"literal placeholder", "a.sh", `echo "${HOME}"`, `echo "$${HOME}"`},
+		{"escaped placeholder", "a.sh", `echo "$${HOME}"`, `echo "$$${HOME}"`},
+		{"literal and path", "a.sh", "${WORKSPACE_ROOT} /home/ann/work", "$${WORKSPACE_ROOT} ${WORKSPACE_ROOT}"},
+		{"path after dollar", "a.txt", "$/home/ann", "$/home/ann"},
+		{"binary", "a.bin", "\x00${HOME}", "\x00${HOME}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			collapsed, err := p.Collapse(tt.rel, []byte(tt.local))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(collapsed) != tt.collapsed {
+				t.Errorf("Collapse = %q, want %q", collapsed, tt.collapsed)
+			}
+			expanded, err := p.Expand(tt.rel, collapsed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(expanded) != tt.local {
+				t.Errorf("Expand = %q, want %q", expanded, tt.local)
+			}
+		})
+	}
+}
+
+func TestExpandOtherDevice(t *testing.T) {
+	p := Placeholders{WorkspaceRoot: `C:\ws`, Home: `C:\Users\ann`}
+
+	tests := []struct {
+		rel, in, want string
+	}{
+		{"a.txt", "${WORKSPACE_ROOT}/x ${HOME}", `C:\ws/x C:\Users\ann`},
+		{"settings.json", `"${HOME}"`, `"C:\\Users\\ann"`},
+		{"a.txt", "$${HOME}", "${HOME}"},
+	}
+	for _, tt := range tests {
+		got, err := p.Expand(tt.rel, []byte(tt.in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("Expand(%s, %q) = %q, want %q", tt.rel, tt.in, got, tt.want)
+		}
+	}
+}
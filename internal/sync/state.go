@@ -0,0 +1,121 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/JPlanken/metarepo-cli/internal/fsutil"
+	"gopkg.in/yaml.v3"
+)
+
+// State records the file hashes of the last successful sync of each pair.
+// It is local to a device and must not be shared through the metarepo.
+type State struct {
+	Pairs map[string]map[string]string `yaml:"pairs"`
+}
+
+// LoadState loads sync state, returning empty state if the file doesn't exist
+func LoadState(path string) (*State, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &State{Pairs: make(map[string]map[string]string)}, nil
+		}
+		return nil, err
+	}
+
+	var s State
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	if s.Pairs == nil {
+		s.Pairs = make(map[string]map[string]string)
+	}
+
+	return &s, nil
+}
+
+// Save saves sync state to a file
+func (s *State) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	data, err := yaml.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	return fsutil.WriteFile(path, data, 0644)
+}
+
+// Base returns the hashes recorded for a pair at its last sync
+func (s *State) Base(key string) map[string]string {
+	if base, ok := s.Pairs[key]; ok {
+		return base
+	}
+	return map[string]string{}
+}
+
+// Record stores the result of syncing paths. Files in kept were left
+// untouched in the destination and keep their previous base, so they are
+// detected as conflicts again until resolved; all other source files become
+// the new base. Entries outside paths are preserved.
+func (s *State) Record(key string, paths []string, sourceHashes map[string]string, kept map[string]bool) {
+	previous := s.Base(key)
+	base := make(map[string]string, len(previous)+len(sourceHashes))
+
+	for rel, hash := range previous {
+		if !underAny(rel, paths) {
+			base[rel] = hash
+		}
+	}
+
+	for rel, hash := range sourceHashes {
+		if !kept[rel] {
+			base[rel] = hash
+		}
+	}
+	for rel := range kept {
+		if hash, ok := previous[rel]; ok {
+			base[rel] = hash
+		}
+	}
+
+	s.Pairs[key] = base
+}
+
+// RenameDevice moves the pairs pushed from or pulled from device oldName,
+// including its repository scopes, to newName. Pairs left behind by an
+// earlier device named newName are dropped.
+func (s *State) RenameDevice(oldName, newName string) {
+	pairs := make(map[string]map[string]string, len(s.Pairs))
+	for key, base := range s.Pairs {
+		// Keys are "<push|pull>/<device>[/repos/<path>]"
+		direction, rest, _ := strings.Cut(key, "/")
+		name, scope, scoped := strings.Cut(rest, "/")
+		switch name {
+		case newName:
+			continue
+		case oldName:
+			key = direction + "/" + newName
+			if scoped {
+				key += "/" + scope
+			}
+		}
+		pairs[key] = base
+	}
+	s.Pairs = pairs
+}
+
+// underAny checks whether rel is one of paths or lies beneath one of them
+func underAny(rel string, paths []string) bool {
+	for _, p := range paths {
+		p = strings.TrimSuffix(filepath.ToSlash(filepath.Clean(p)), "/")
+		if rel == p || strings.HasPrefix(rel, p+"/") {
+			return true
+		}
+	}
+	return false
+}
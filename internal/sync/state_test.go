@@ -0,0 +1,33 @@
+package sync
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestStateRenameDevice(t *testing.T) {
+	s := &State{Pairs: map[string]map[string]string{
+		"push/laptop":           {"a": "1"},
+		"push/laptop/repos/api": {"b": "2"},
+		"pull/laptop":           {"c": "3"},
+		"pull/laptop-old":       {"d": "4"},
+		"pull/desktop":          {"e": "5"},
+		"pull/work":             {"f": "6"},
+		"push/work/repos/api":   {"g": "7"},
+	}}
+	s.RenameDevice("laptop", "work")
+
+	var keys []string
+	for key := range s.Pairs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	want := "pull/desktop,pull/laptop-old,pull/work,push/work,push/work/repos/api"
+	if got := strings.Join(keys, ","); got != want {
+		t.Fatalf("keys = %s, want %s", got, want)
+	}
+	if s.Pairs["pull/work"]["c"] != "3" || s.Pairs["push/work/repos/api"]["b"] != "2" {
+		t.Errorf("pairs not moved with their keys: %v", s.Pairs)
+	}
+}
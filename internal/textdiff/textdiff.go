@@ -0,0 +1,192 @@
+// Package textdiff computes line diffs and formats them as unified diffs.
+package textdiff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Edit kinds
+const (
+	Equal  = ' '
+	Delete = '-'
+	Insert = '+'
+)
+
+// Edit is one line of an edit script
+type Edit struct {
+	Kind byte
+	Line string // including its trailing newline, if any
+}
+
+// Result is the difference between two texts
+type Result struct {
+	Edits      []Edit
+	Insertions int
+	Deletions  int
+}
+
+// Compute diffs two texts line by line
+func Compute(a, b []byte) *Result {
+	edits := myers(splitLines(string(a)), splitLines(string(b)))
+	r := &Result{Edits: edits}
+	for _, e := range edits {
+		switch e.Kind {
+		case Insert:
+			r.Insertions++
+		case Delete:
+			r.Deletions++
+		}
+	}
+	return r
+}
+
+// Unified formats the result as a unified diff with context lines around
+// each change. It returns "" if the texts are equal.
+func (r *Result) Unified(oldName, newName string, context int) string {
+	if r.Insertions == 0 && r.Deletions == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+
+	// Line numbers (1-based) of each edit in the old and new text
+	oldLine := make([]int, len(r.Edits))
+	newLine := make([]int, len(r.Edits))
+	o, n := 1, 1
+	for i, e := range r.Edits {
+		oldLine[i], newLine[i] = o, n
+		if e.Kind != Insert {
+			o++
+		}
+		if e.Kind != Delete {
+			n++
+		}
+	}
+
+	for i := 0; i < len(r.Edits); {
+		if r.Edits[i].Kind == Equal {
+			i++
+			continue
+		}
+
+		// Extend the hunk while the next change is within reach of the context
+		start := max(0, i-context)
+		end := i
+		for j := i; j < len(r.Edits); j++ {
+			if r.Edits[j].Kind != Equal {
+				end = j
+			} else if j-end > 2*context {
+				break
+			}
+		}
+		end = min(len(r.Edits), end+context+1)
+
+		oldCount, newCount := 0, 0
+		for _, e := range r.Edits[start:end] {
+			if e.Kind != Insert {
+				oldCount++
+			}
+			if e.Kind != Delete {
+				newCount++
+			}
+		}
+		oldStart, newStart := oldLine[start], newLine[start]
+		if oldCount == 0 {
+			oldStart--
+		}
+		if newCount == 0 {
+			newStart--
+		}
+
+		fmt.Fprintf(&b, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+		for _, e := range r.Edits[start:end] {
+			b.WriteByte(e.Kind)
+			b.WriteString(e.Line)
+			if !strings.HasSuffix(e.Line, "\n") {
+				b.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = end
+	}
+
+	return b.String()
+}
+
+// splitLines splits text after each newline
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// myers returns the shortest edit script turning a into b
+func myers(a, b []string) []Edit {
+	n, m := len(a), len(b)
+	limit := n + m
+	offset := limit + 1
+	v := make([]int, 2*limit+2)
+	var trace [][]int
+
+search:
+	for d := 0; d <= limit; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	// Walk the trace back from the end to recover the edits
+	var edits []Edit
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			edits = append(edits, Edit{Kind: Equal, Line: a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				edits = append(edits, Edit{Kind: Insert, Line: b[y-1]})
+				y--
+			} else {
+				edits = append(edits, Edit{Kind: Delete, Line: a[x-1]})
+				x--
+			}
+		}
+	}
+
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}